@@ -4,6 +4,8 @@ import (
 	"flag"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 
 	"wrzapi/internal/server"
 )
@@ -13,10 +15,16 @@ func main() {
 	var port string
 	var navData string
 	var navDev bool
+	var navSnapshots int
+	var navTrashDays int
+	var navTrustedProxies string
 	flag.StringVar(&serverURL, "server-url", "", "OpenAPI server URL (overrides SERVER_URL env)")
 	flag.StringVar(&port, "port", "", "HTTP listen port (overrides PORT env)")
-	flag.StringVar(&navData, "nav-data", "", "Nav data file path (overrides NAV_DATA env)")
+	flag.StringVar(&navData, "nav-data", "", "Nav data file path or sqlite:///path.db (overrides NAV_DATA env)")
 	flag.BoolVar(&navDev, "nav-dev", false, "Serve nav frontend from disk for hot reload")
+	flag.IntVar(&navSnapshots, "nav-snapshots", 0, "Nav snapshots to keep, default 20, negative disables (overrides NAV_SNAPSHOTS env)")
+	flag.IntVar(&navTrashDays, "nav-trash-days", 0, "Days to keep deleted nav records in the trash, default 30 (overrides NAV_TRASH_DAYS env)")
+	flag.StringVar(&navTrustedProxies, "nav-trusted-proxies", "", "Comma-separated reverse proxy IPs or CIDRs whose X-Real-IP/X-Forwarded-For the nav app trusts (overrides NAV_TRUSTED_PROXIES env)")
 	flag.Parse()
 
 	if serverURL != "" {
@@ -37,9 +45,22 @@ func main() {
 		}
 	}
 
+	if navSnapshots == 0 {
+		navSnapshots = intEnv("NAV_SNAPSHOTS")
+	}
+	if navTrashDays == 0 {
+		navTrashDays = intEnv("NAV_TRASH_DAYS")
+	}
+	if navTrustedProxies == "" {
+		navTrustedProxies = os.Getenv("NAV_TRUSTED_PROXIES")
+	}
+
 	srv, err := server.New(server.Config{
-		NavDataPath: navData,
-		NavDev:      navDev,
+		NavDataPath:       navData,
+		NavDev:            navDev,
+		NavSnapshotKeep:   navSnapshots,
+		NavTrashDays:      navTrashDays,
+		NavTrustedProxies: strings.Split(navTrustedProxies, ","),
 	})
 	if err != nil {
 		log.Fatal(err)
@@ -50,3 +71,15 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+func intEnv(key string) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", key, err)
+	}
+	return n
+}
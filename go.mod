@@ -3,7 +3,11 @@ module wrzapi
 go 1.23.0
 
 require (
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/gin-gonic/gin v1.11.0
+	github.com/mattn/go-sqlite3 v1.14.52
+	github.com/mozillazg/go-pinyin v0.21.0
+	golang.org/x/image v0.29.0
 	golang.org/x/net v0.42.0
 	gopkg.in/yaml.v3 v3.0.1
 )
@@ -4,20 +4,43 @@ import (
 	"context"
 	"errors"
 	"io"
+	"net"
 	"net/http"
 	"time"
 )
 
-const maxBytes = 2 << 20 // 2MB
+const (
+	maxBytes      = 2 << 20   // 2MB
+	maxImageBytes = 512 << 10 // 512KB
+	maxRedirects  = 10
+)
+
+var (
+	ErrFetch    = errors.New("failed to fetch page")
+	ErrTooLarge = errors.New("response too large")
 
-var ErrFetch = errors.New("failed to fetch page")
+	ErrTimeout          = errors.New("request timed out")
+	ErrNoHost           = errors.New("host not found")
+	ErrTooManyRedirects = errors.New("too many redirects")
+)
 
 type Client struct {
 	hc *http.Client
+	// noRedirect returns redirects instead of following them, so that
+	// CheckLink can see each hop.
+	noRedirect *http.Client
 }
 
 func New() *Client {
-	return &Client{hc: &http.Client{Timeout: 12 * time.Second}}
+	return &Client{
+		hc: &http.Client{Timeout: 12 * time.Second},
+		noRedirect: &http.Client{
+			Timeout: 12 * time.Second,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
 }
 
 func (c *Client) FetchHTML(ctx context.Context, rawURL string) ([]byte, string, error) {
@@ -46,3 +69,121 @@ func (c *Client) FetchHTML(ctx context.Context, rawURL string) ([]byte, string,
 
 	return body, resp.Request.URL.String(), nil
 }
+
+// FetchImage downloads an image and returns it with its Content-Type.
+// Responses over 512KB fail with ErrTooLarge instead of being truncated.
+func (c *Client) FetchImage(ctx context.Context, rawURL string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, "", ErrFetch
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/144.0.0.0 Safari/537.36 Notelook/1.0")
+	req.Header.Set("Accept", "image/png,image/*;q=0.8")
+
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, "", ErrFetch
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, "", ErrFetch
+	}
+	if resp.ContentLength > maxImageBytes {
+		return nil, "", ErrTooLarge
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxImageBytes+1))
+	if err != nil {
+		return nil, "", ErrFetch
+	}
+	if len(body) > maxImageBytes {
+		return nil, "", ErrTooLarge
+	}
+
+	return body, resp.Header.Get("Content-Type"), nil
+}
+
+// LinkStatus is the outcome of CheckLink. FinalURL is where redirects
+// ended, and Permanent reports whether there was at least one redirect and
+// every one of them was a 301 or 308.
+type LinkStatus struct {
+	StatusCode int
+	FinalURL   string
+	Permanent  bool
+	Latency    time.Duration
+}
+
+// CheckLink reports whether rawURL is reachable. It sends HEAD, retrying
+// with GET when the server rejects HEAD, and follows up to 10 redirects
+// itself so they can be reported. Bodies are never read. Failures are
+// ErrTimeout, ErrNoHost, ErrTooManyRedirects or ErrFetch; the status
+// fields are filled as far as the check got.
+func (c *Client) CheckLink(ctx context.Context, rawURL string) (LinkStatus, error) {
+	start := time.Now()
+	status := LinkStatus{FinalURL: rawURL}
+	permanent := true
+	for hop := 0; ; hop++ {
+		resp, err := c.probe(ctx, status.FinalURL)
+		if err != nil {
+			status.Latency = time.Since(start)
+			return status, err
+		}
+		status.StatusCode = resp.StatusCode
+		location := resp.Header.Get("Location")
+		if resp.StatusCode < 300 || resp.StatusCode > 399 || location == "" {
+			break
+		}
+		if hop == maxRedirects {
+			status.Latency = time.Since(start)
+			return status, ErrTooManyRedirects
+		}
+		next, err := resp.Request.URL.Parse(location)
+		if err != nil {
+			status.Latency = time.Since(start)
+			return status, ErrFetch
+		}
+		permanent = permanent && (resp.StatusCode == http.StatusMovedPermanently || resp.StatusCode == http.StatusPermanentRedirect)
+		status.FinalURL = next.String()
+		status.Permanent = permanent
+	}
+	status.Latency = time.Since(start)
+	return status, nil
+}
+
+// probe sends HEAD and falls back to GET when that fails with a client or
+// server error, which many sites answer HEAD with regardless of the page.
+func (c *Client) probe(ctx context.Context, rawURL string) (*http.Response, error) {
+	resp, err := c.request(ctx, http.MethodHead, rawURL)
+	if err != nil || resp.StatusCode < 400 {
+		return resp, err
+	}
+	if get, err := c.request(ctx, http.MethodGet, rawURL); err == nil {
+		return get, nil
+	}
+	return resp, nil
+}
+
+func (c *Client) request(ctx context.Context, method, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return nil, ErrFetch
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/144.0.0.0 Safari/537.36 Notelook/1.0")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+
+	resp, err := c.noRedirect.Do(req)
+	if err != nil {
+		var dnsErr *net.DNSError
+		var netErr net.Error
+		switch {
+		case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+			return nil, ErrNoHost
+		case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+			return nil, ErrTimeout
+		}
+		return nil, ErrFetch
+	}
+	resp.Body.Close()
+	return resp, nil
+}
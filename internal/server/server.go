@@ -2,6 +2,7 @@ package server
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -14,8 +15,11 @@ type Server struct {
 }
 
 type Config struct {
-	NavDataPath string
-	NavDev      bool
+	NavDataPath       string
+	NavDev            bool
+	NavSnapshotKeep   int
+	NavTrashDays      int
+	NavTrustedProxies []string
 }
 
 func New(cfg Config) (*Server, error) {
@@ -30,8 +34,11 @@ func New(cfg Config) (*Server, error) {
 	engine.GET("/docs", handlers.Docs)
 
 	navApp, err := nav.New(nav.Config{
-		DataPath: cfg.NavDataPath,
-		Dev:      cfg.NavDev,
+		DataPath:       cfg.NavDataPath,
+		Dev:            cfg.NavDev,
+		SnapshotKeep:   cfg.NavSnapshotKeep,
+		TrashRetention: time.Duration(cfg.NavTrashDays) * 24 * time.Hour,
+		TrustedProxies: cfg.NavTrustedProxies,
 	})
 	if err != nil {
 		return nil, err
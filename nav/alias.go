@@ -0,0 +1,208 @@
+package nav
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	maxAliasLength   = 64
+	maxAliasSegments = 8
+)
+
+// reservedAliasRoots are the first path segments taken by built-in routes
+// of the nav app and the API server in front of it.
+var reservedAliasRoots = map[string]bool{
+	"admin": true, "login": true, "api": true, "assets": true, "icons": true, "go": true,
+	"docs": true, "healthz": true, "favicon.ico": true, "manifest.json": true,
+	"openapi.yaml": true, "openapi.json": true, "index.html": true,
+}
+
+var (
+	aliasSegment     = regexp.MustCompile(`^[a-z0-9][a-z0-9._~-]*$`)
+	aliasParam       = regexp.MustCompile(`^\{([a-z0-9_]+)\}$`)
+	urlTemplateParam = regexp.MustCompile(`\{([a-zA-Z0-9_]+)\}`)
+	allDigits        = regexp.MustCompile(`^[0-9]+$`)
+
+	errAliasInUse = errors.New("alias already in use")
+)
+
+// normalizeAlias lowercases an alias and trims surrounding slashes. An
+// alias is a path of literal segments and {name} parameters; the first
+// segment must be a literal that is neither a built-in route nor a number
+// (which /go/{id} would take). Parameters must all be used by url, and
+// url may only use parameters the alias defines.
+func normalizeAlias(alias, rawURL string) (string, error) {
+	alias = strings.ToLower(strings.Trim(strings.TrimSpace(alias), "/"))
+	if alias == "" {
+		return "", nil
+	}
+	if len(alias) > maxAliasLength {
+		return "", fmt.Errorf("alias longer than %d characters", maxAliasLength)
+	}
+	segments := strings.Split(alias, "/")
+	if len(segments) > maxAliasSegments {
+		return "", fmt.Errorf("alias has more than %d segments", maxAliasSegments)
+	}
+	params := map[string]bool{}
+	for i, seg := range segments {
+		if m := aliasParam.FindStringSubmatch(seg); m != nil && i > 0 {
+			if params[m[1]] {
+				return "", fmt.Errorf("alias repeats parameter {%s}", m[1])
+			}
+			params[m[1]] = true
+			continue
+		}
+		if !aliasSegment.MatchString(seg) {
+			return "", fmt.Errorf("invalid alias segment %q", seg)
+		}
+	}
+	if reservedAliasRoots[segments[0]] || allDigits.MatchString(segments[0]) {
+		return "", fmt.Errorf("alias %q is reserved", segments[0])
+	}
+	used := map[string]bool{}
+	for _, m := range urlTemplateParam.FindAllStringSubmatch(rawURL, -1) {
+		name := strings.ToLower(m[1])
+		if !params[name] {
+			return "", fmt.Errorf("url uses {%s}, which the alias does not define", m[1])
+		}
+		used[name] = true
+	}
+	for name := range params {
+		if !used[name] {
+			return "", fmt.Errorf("alias parameter {%s} is not used in the url", name)
+		}
+	}
+	return alias, nil
+}
+
+// aliasKey identifies the paths an alias matches: aliases that differ only
+// in parameter names collide.
+func aliasKey(alias string) string {
+	segments := strings.Split(alias, "/")
+	for i, seg := range segments {
+		if aliasParam.MatchString(seg) {
+			segments[i] = "{}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// aliasTaken reports whether another item than id already has an alias
+// matching the same paths.
+func aliasTaken(items []Item, alias string, id uint32) bool {
+	if alias == "" {
+		return false
+	}
+	key := aliasKey(alias)
+	for _, item := range items {
+		if item.ID != id && item.Alias != "" && aliasKey(item.Alias) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// duplicateAliases returns the indexes of items whose alias collides with
+// an earlier item's.
+func duplicateAliases(items []Item) []int {
+	seen := map[string]bool{}
+	var out []int
+	for i, item := range items {
+		if item.Alias == "" {
+			continue
+		}
+		key := aliasKey(item.Alias)
+		if seen[key] {
+			out = append(out, i)
+		}
+		seen[key] = true
+	}
+	return out
+}
+
+// resolveAlias finds the item for a request path and returns the URL to
+// redirect to. Literal aliases win over parameterized ones; among those,
+// the alias with the most literal segments wins. Items for which skip
+// returns true are ignored.
+func resolveAlias(items []Item, path string, skip func(Item) bool) (Item, string, bool) {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return Item{}, "", false
+	}
+	parts := strings.Split(path, "/")
+	var best Item
+	var bestValues map[string]string
+	bestLiterals := -1
+	for _, item := range items {
+		if item.Alias == "" || skip(item) {
+			continue
+		}
+		segments := strings.Split(item.Alias, "/")
+		if len(segments) != len(parts) {
+			continue
+		}
+		values := map[string]string{}
+		literals := 0
+		for i, seg := range segments {
+			if m := aliasParam.FindStringSubmatch(seg); m != nil {
+				values[m[1]] = parts[i]
+				continue
+			}
+			if !strings.EqualFold(seg, parts[i]) {
+				values = nil
+				break
+			}
+			literals++
+		}
+		if values != nil && literals > bestLiterals {
+			best, bestValues, bestLiterals = item, values, literals
+		}
+	}
+	if bestLiterals < 0 {
+		return Item{}, "", false
+	}
+	return best, expandURLTemplate(best.URL, bestValues), true
+}
+
+// expandURLTemplate fills {name} placeholders, escaping values as path
+// segments before the query and as query values after it.
+func expandURLTemplate(template string, values map[string]string) string {
+	if len(values) == 0 {
+		return template
+	}
+	query := strings.IndexByte(template, '?')
+	var b strings.Builder
+	last := 0
+	for _, loc := range urlTemplateParam.FindAllStringSubmatchIndex(template, -1) {
+		b.WriteString(template[last:loc[0]])
+		value := values[strings.ToLower(template[loc[2]:loc[3]])]
+		if query >= 0 && loc[0] > query {
+			b.WriteString(url.QueryEscape(value))
+		} else {
+			b.WriteString(url.PathEscape(value))
+		}
+		last = loc[1]
+	}
+	b.WriteString(template[last:])
+	return b.String()
+}
+
+// handleAlias redirects a go-link such as /jira or /ticket/123.
+func (s *AppState) handleAlias(w http.ResponseWriter, r *http.Request, path string) {
+	_, admin := s.sessionUserFor(r)
+	s.mu.Lock()
+	item, target, ok := resolveAlias(s.items, path, func(item Item) bool {
+		return !admin && itemHidden(item, s.hiddenCats)
+	})
+	s.mu.Unlock()
+	if !ok {
+		writeText(w, http.StatusNotFound, "not found")
+		return
+	}
+	s.redirectVisit(w, r, item.ID, target)
+}
@@ -6,37 +6,53 @@ import (
 	"crypto/subtle"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"wrzapi/frontend"
 )
 
 type Config struct {
-	DataPath string
-	Dev      bool
+	DataPath       string
+	Dev            bool
+	SnapshotKeep   int
+	TrashRetention time.Duration
+	// TrustedProxies lists the reverse proxies (IPs or CIDR ranges) whose
+	// X-Real-IP and X-Forwarded-For headers are believed.
+	TrustedProxies []string
 }
 
 type Category struct {
-	ID    uint32 `json:"id"`
-	Name  string `json:"name"`
-	Order int32  `json:"order"`
-}
-
-type Item struct {
 	ID         uint32  `json:"id"`
 	Name       string  `json:"name"`
-	URL        string  `json:"url"`
-	CategoryID *uint32 `json:"category_id"`
+	ParentID   *uint32 `json:"parent_id"`
 	Order      int32   `json:"order"`
-	AvatarURL  string  `json:"avatar_url"`
-	Summary    string  `json:"summary"`
+	Visibility string  `json:"visibility,omitempty"`
+	Rev        uint64  `json:"rev"`
+}
+
+type Item struct {
+	ID         uint32   `json:"id"`
+	Name       string   `json:"name"`
+	URL        string   `json:"url"`
+	Alias      string   `json:"alias,omitempty"`
+	CategoryID *uint32  `json:"category_id"`
+	Order      int32    `json:"order"`
+	AvatarURL  string   `json:"avatar_url"`
+	Summary    string   `json:"summary"`
+	Tags       []string `json:"tags,omitempty"`
+	Visibility string   `json:"visibility,omitempty"`
+	Rev        uint64   `json:"rev"`
 }
 
 type AdminAuth struct {
@@ -45,20 +61,35 @@ type AdminAuth struct {
 }
 
 type DataFile struct {
-	NextID     uint32     `json:"next_id"`
-	Categories []Category `json:"categories"`
-	Items      []Item     `json:"items"`
-	Admin      AdminAuth  `json:"admin"`
+	SchemaVersion int          `json:"schema_version"`
+	NextID        uint32       `json:"next_id"`
+	Categories    []Category   `json:"categories"`
+	Items         []Item       `json:"items"`
+	Admin         AdminAuth    `json:"admin"`
+	Trash         []TrashEntry `json:"trash,omitempty"`
 }
 
 type AppState struct {
 	mu         sync.Mutex
-	dataPath   string
+	store      Store
 	nextID     uint32
 	items      []Item
 	categories []Category
 	admin      AdminAuth
 	sessions   map[string]string
+	snapshots  *snapshotter
+	events     *eventHub
+	auditLog   *auditLog
+	visits     *visitLog
+	trash      []TrashEntry
+	search     *searchIndex
+	enricher   *enricher
+	icons      *iconCache
+	links      *linkChecker
+	hiddenCats map[uint32]bool
+
+	trashRetention time.Duration
+	trustedProxies []netip.Prefix
 }
 
 type App struct {
@@ -72,19 +103,72 @@ func New(cfg Config) (*App, error) {
 	if strings.TrimSpace(dataPath) == "" {
 		dataPath = "data.json"
 	}
+	trustedProxies, err := parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
 
-	data, err := loadData(dataPath)
+	store, err := openStore(dataPath)
+	if err != nil {
+		return nil, fmt.Errorf("open nav data %s: %w", dataPath, err)
+	}
+	data, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("load nav data %s: %w", dataPath, err)
+	}
+	sessions, err := store.Sessions()
+	if err != nil {
+		return nil, fmt.Errorf("load nav sessions: %w", err)
+	}
+	auditLog, err := openAuditLog(storePath(dataPath) + ".audit.jsonl")
 	if err != nil {
-		data = DataFile{NextID: 1, Categories: []Category{}, Items: []Item{}, Admin: defaultAdmin()}
+		return nil, err
+	}
+	visits, err := openVisitLog(storePath(dataPath) + ".visits.jsonl")
+	if err != nil {
+		return nil, err
 	}
 
 	state := &AppState{
-		dataPath:   dataPath,
+		store:      store,
 		nextID:     data.NextID,
 		items:      data.Items,
 		categories: data.Categories,
 		admin:      data.Admin,
-		sessions:   map[string]string{},
+		sessions:   sessions,
+		snapshots:  newSnapshotter(storePath(dataPath)+".snapshots", cfg.SnapshotKeep),
+		events:     newEventHub(),
+		auditLog:   auditLog,
+		visits:     visits,
+		trash:      data.Trash,
+		search:     newSearchIndex(),
+		enricher:   newEnricher(),
+		icons:      newIconCache(storePath(dataPath) + ".icons"),
+		links:      newLinkChecker(storePath(dataPath) + ".health.json"),
+
+		trashRetention: cfg.TrashRetention,
+		trustedProxies: trustedProxies,
+	}
+	if state.trash == nil {
+		state.trash = []TrashEntry{}
+	}
+	state.search.sync(state.items, state.categories)
+	state.hiddenCats = hiddenCategories(state.categories)
+	if state.trashRetention <= 0 {
+		state.trashRetention = defaultTrashRetention
+	}
+	if list, err := state.snapshots.list(); err == nil && len(list) == 0 {
+		state.snapshots.take(data)
+	}
+	if _, ok := store.(reloadableStore); ok {
+		watchFile(storePath(dataPath), state.reloadFromDisk)
+	}
+	go state.runTrashPurger()
+	go state.runIconRefresher()
+	go state.runLinkChecker()
+	go state.runVisitCompactor()
+	if state.snapshots != nil {
+		go state.runSnapshotter()
 	}
 
 	var distFS fs.FS
@@ -107,7 +191,11 @@ func New(cfg Config) (*App, error) {
 
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
-			writeText(w, http.StatusNotFound, "not found")
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				writeText(w, http.StatusNotFound, "not found")
+				return
+			}
+			state.handleAlias(w, r, r.URL.Path)
 			return
 		}
 		serveIndex(w, distFS)
@@ -141,10 +229,60 @@ func New(cfg Config) (*App, error) {
 		serveIndex(w, distFS)
 	})
 
+	mux.HandleFunc("/icons/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeText(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		idVal, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/icons/"), 10, 32)
+		if err != nil {
+			writeText(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+		state.handleIcon(w, r, uint32(idVal))
+	})
+
+	mux.HandleFunc("/go/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeText(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		rest := strings.TrimPrefix(r.URL.Path, "/go/")
+		if idVal, err := strconv.ParseUint(rest, 10, 32); err == nil {
+			state.handleGo(w, r, uint32(idVal))
+			return
+		}
+		state.handleAlias(w, r, rest)
+	})
+
+	mux.HandleFunc("/api/stats/items", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeText(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		state.handleItemStats(w, r)
+	})
+
+	mux.HandleFunc("/api/health/items", state.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeText(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		state.handleItemHealth(w, r)
+	}))
+
+	mux.HandleFunc("/api/avatar.svg", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeText(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		state.handleAvatar(w, r)
+	})
+
 	mux.HandleFunc("/api/data", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			state.handleGetData(w)
+			state.handleGetData(w, r)
 		case http.MethodPost:
 			state.requireAuth(func(w http.ResponseWriter, r *http.Request) {
 				state.handleRestore(w, r)
@@ -154,6 +292,46 @@ func New(cfg Config) (*App, error) {
 		}
 	})
 
+	mux.HandleFunc("/api/search", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeText(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		state.handleSearch(w, r)
+	})
+
+	mux.HandleFunc("/api/tags", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeText(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		state.handleListTags(w, r)
+	})
+
+	mux.HandleFunc("/api/tags/", state.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		tag, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/api/tags/"))
+		if err != nil || strings.TrimSpace(tag) == "" {
+			writeText(w, http.StatusBadRequest, "invalid tag")
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			state.handleRenameTag(w, r, tag)
+		case http.MethodDelete:
+			state.handleDeleteTag(w, r, tag)
+		default:
+			writeText(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}))
+
+	mux.HandleFunc("/api/events", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeText(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		state.handleEvents(w, r)
+	})
+
 	mux.HandleFunc("/api/login", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			writeText(w, http.StatusMethodNotAllowed, "method not allowed")
@@ -167,7 +345,7 @@ func New(cfg Config) (*App, error) {
 			writeText(w, http.StatusMethodNotAllowed, "method not allowed")
 			return
 		}
-		state.handleLogout(w)
+		state.handleLogout(w, r)
 	})
 
 	mux.HandleFunc("/api/password", state.requireAuth(func(w http.ResponseWriter, r *http.Request) {
@@ -187,7 +365,8 @@ func New(cfg Config) (*App, error) {
 	}))
 
 	mux.HandleFunc("/api/category/", state.requireAuth(func(w http.ResponseWriter, r *http.Request) {
-		idStr := strings.TrimPrefix(r.URL.Path, "/api/category/")
+		rest := strings.TrimPrefix(r.URL.Path, "/api/category/")
+		idStr, action, _ := strings.Cut(rest, "/")
 		if idStr == "" {
 			writeText(w, http.StatusBadRequest, "invalid id")
 			return
@@ -198,14 +377,26 @@ func New(cfg Config) (*App, error) {
 			return
 		}
 		id := uint32(idVal)
-		switch r.Method {
-		case http.MethodPut:
+		switch {
+		case action == "" && r.Method == http.MethodPut:
 			state.handleUpdateCategory(w, r, id)
-		case http.MethodDelete:
-			state.handleDeleteCategory(w, id)
+		case action == "" && r.Method == http.MethodDelete:
+			state.handleDeleteCategory(w, r, id)
+		case action == "reorder" && r.Method == http.MethodPost:
+			state.handleReorderItems(w, r, id)
+		case action == "" || action == "reorder":
+			writeText(w, http.StatusMethodNotAllowed, "method not allowed")
 		default:
+			writeText(w, http.StatusNotFound, "not found")
+		}
+	}))
+
+	mux.HandleFunc("/api/categories/reorder", state.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
 			writeText(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
 		}
+		state.handleReorderCategories(w, r)
 	}))
 
 	mux.HandleFunc("/api/item", state.requireAuth(func(w http.ResponseWriter, r *http.Request) {
@@ -217,7 +408,8 @@ func New(cfg Config) (*App, error) {
 	}))
 
 	mux.HandleFunc("/api/item/", state.requireAuth(func(w http.ResponseWriter, r *http.Request) {
-		idStr := strings.TrimPrefix(r.URL.Path, "/api/item/")
+		rest := strings.TrimPrefix(r.URL.Path, "/api/item/")
+		idStr, action, _ := strings.Cut(rest, "/")
 		if idStr == "" {
 			writeText(w, http.StatusBadRequest, "invalid id")
 			return
@@ -228,16 +420,115 @@ func New(cfg Config) (*App, error) {
 			return
 		}
 		id := uint32(idVal)
-		switch r.Method {
-		case http.MethodPut:
+		switch {
+		case action == "" && r.Method == http.MethodPut:
 			state.handleUpdateItem(w, r, id)
+		case action == "" && r.Method == http.MethodDelete:
+			state.handleDeleteItem(w, r, id)
+		case action == "move" && r.Method == http.MethodPost:
+			state.handleMoveItem(w, r, id)
+		case action == "refresh" && r.Method == http.MethodPost:
+			state.handleRefreshItem(w, r, id)
+		case action == "follow-redirect" && r.Method == http.MethodPost:
+			state.handleFollowRedirect(w, r, id)
+		case action == "" || action == "move" || action == "refresh" || action == "follow-redirect":
+			writeText(w, http.StatusMethodNotAllowed, "method not allowed")
+		default:
+			writeText(w, http.StatusNotFound, "not found")
+		}
+	}))
+
+	mux.HandleFunc("/api/batch", state.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeText(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		state.handleBatch(w, r)
+	}))
+
+	mux.HandleFunc("/api/export", state.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeText(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		state.handleExport(w, r)
+	}))
+
+	mux.HandleFunc("/api/import", state.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeText(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		state.handleImport(w, r)
+	}))
+
+	mux.HandleFunc("/api/trash", state.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			state.handleListTrash(w)
 		case http.MethodDelete:
-			state.handleDeleteItem(w, id)
+			state.handleEmptyTrash(w, r)
 		default:
 			writeText(w, http.StatusMethodNotAllowed, "method not allowed")
 		}
 	}))
 
+	mux.HandleFunc("/api/trash/", state.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		rest := strings.TrimPrefix(r.URL.Path, "/api/trash/")
+		idStr, action, _ := strings.Cut(rest, "/")
+		idVal, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			writeText(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+		id := uint32(idVal)
+		switch {
+		case action == "" && r.Method == http.MethodDelete:
+			state.handlePurgeTrash(w, r, id)
+		case action == "restore" && r.Method == http.MethodPost:
+			state.handleRestoreTrash(w, r, id)
+		case action == "" || action == "restore":
+			writeText(w, http.StatusMethodNotAllowed, "method not allowed")
+		default:
+			writeText(w, http.StatusNotFound, "not found")
+		}
+	}))
+
+	mux.HandleFunc("/api/audit", state.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeText(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		state.handleAudit(w, r)
+	}))
+
+	mux.HandleFunc("/api/snapshots", state.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeText(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		state.handleListSnapshots(w)
+	}))
+
+	mux.HandleFunc("/api/snapshots/", state.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		rest := strings.TrimPrefix(r.URL.Path, "/api/snapshots/")
+		id, action, _ := strings.Cut(rest, "/")
+		if id == "" {
+			writeText(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+		switch {
+		case action == "diff" && r.Method == http.MethodGet:
+			state.handleSnapshotDiff(w, id)
+		case action == "restore" && r.Method == http.MethodPost:
+			state.handleRollback(w, r, id)
+		case action == "diff" || action == "restore":
+			writeText(w, http.StatusMethodNotAllowed, "method not allowed")
+		default:
+			writeText(w, http.StatusNotFound, "not found")
+		}
+	}))
+
 	return &App{state: state, mux: mux, distFS: distFS}, nil
 }
 
@@ -261,70 +552,6 @@ func defaultAdmin() AdminAuth {
 	return AdminAuth{Username: "admin", PasswordHash: hashPassword("admin")}
 }
 
-func loadData(path string) (DataFile, error) {
-	raw, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return DataFile{NextID: 1, Categories: []Category{}, Items: []Item{}, Admin: defaultAdmin()}, nil
-		}
-		return DataFile{}, err
-	}
-	if len(raw) == 0 {
-		return DataFile{NextID: 1, Categories: []Category{}, Items: []Item{}, Admin: defaultAdmin()}, nil
-	}
-	var data DataFile
-	if err := json.Unmarshal(raw, &data); err == nil {
-		if data.NextID == 0 {
-			data.NextID = 1
-		}
-		if data.Admin.Username == "" || data.Admin.PasswordHash == "" {
-			data.Admin = defaultAdmin()
-		}
-		return data, nil
-	}
-
-	var rawMap map[string]json.RawMessage
-	if err := json.Unmarshal(raw, &rawMap); err != nil {
-		return DataFile{NextID: 1, Categories: []Category{}, Items: []Item{}, Admin: defaultAdmin()}, nil
-	}
-
-	out := DataFile{NextID: 1, Categories: []Category{}, Items: []Item{}, Admin: defaultAdmin()}
-	if v, ok := rawMap["next_id"]; ok {
-		var next uint32
-		if err := json.Unmarshal(v, &next); err == nil && next > 0 {
-			out.NextID = next
-		}
-	}
-	if v, ok := rawMap["categories"]; ok {
-		var cats []Category
-		if err := json.Unmarshal(v, &cats); err == nil {
-			out.Categories = cats
-		}
-	}
-	if v, ok := rawMap["items"]; ok {
-		var items []Item
-		if err := json.Unmarshal(v, &items); err == nil {
-			out.Items = items
-		}
-	}
-	if v, ok := rawMap["admin"]; ok {
-		var admin AdminAuth
-		if err := json.Unmarshal(v, &admin); err == nil && admin.Username != "" && admin.PasswordHash != "" {
-			out.Admin = admin
-		}
-	}
-	return out, nil
-}
-
-func (s *AppState) save() error {
-	data := DataFile{NextID: s.nextID, Categories: s.categories, Items: s.items, Admin: s.admin}
-	payload, err := json.MarshalIndent(data, "", "  ")
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(s.dataPath, payload, 0644)
-}
-
 func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(status)
@@ -339,65 +566,116 @@ func writeText(w http.ResponseWriter, status int, text string) {
 	_, _ = w.Write([]byte(text))
 }
 
+func writeSaveError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errDataConflict) {
+		writeText(w, http.StatusConflict, "data changed on disk, reload and retry")
+		return
+	}
+	writeText(w, http.StatusInternalServerError, "save failed")
+}
+
 func readBody(r *http.Request, limit int64) ([]byte, error) {
 	defer r.Body.Close()
 	return io.ReadAll(io.LimitReader(r.Body, limit))
 }
 
+// bodyFields returns the top-level keys of a JSON object body. Update
+// handlers keep the stored value of optional fields a client leaves out.
+func bodyFields(body []byte) map[string]bool {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil
+	}
+	fields := make(map[string]bool, len(doc))
+	for key := range doc {
+		fields[key] = true
+	}
+	return fields
+}
+
 func (s *AppState) requireAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("nav_session")
-		if err != nil || cookie.Value == "" {
-			writeText(w, http.StatusUnauthorized, "unauthorized")
-			return
-		}
-		s.mu.Lock()
-		_, ok := s.sessions[cookie.Value]
-		s.mu.Unlock()
+		user, ok := s.sessionUserFor(r)
 		if !ok {
 			writeText(w, http.StatusUnauthorized, "unauthorized")
 			return
 		}
-		next(w, r)
+		next(w, withSessionUser(r, user))
 	}
 }
 
-func (s *AppState) handleGetData(w http.ResponseWriter) {
+// sessionUserFor returns the admin logged in with the request's session
+// cookie, for endpoints that are public but show more to admins.
+func (s *AppState) sessionUserFor(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie("nav_session")
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	writeJSON(w, http.StatusOK, DataFile{NextID: s.nextID, Categories: s.categories, Items: s.items, Admin: AdminAuth{Username: s.admin.Username}})
+	user, ok := s.sessions[cookie.Value]
+	return user, ok
 }
 
-func (s *AppState) handleRestore(w http.ResponseWriter, r *http.Request) {
-	body, err := readBody(r, 5*1024*1024)
-	if err != nil {
-		writeText(w, http.StatusBadRequest, "invalid body")
-		return
+// commit persists a change through the store and, once it is durable,
+// applies it to the in-memory state. Callers must hold s.mu.
+func (s *AppState) commit(persist func(tx StoreTx) error, apply func()) error {
+	if err := s.store.Update(persist); err != nil {
+		return err
 	}
-	var data DataFile
-	if err := json.Unmarshal(body, &data); err != nil {
-		writeText(w, http.StatusBadRequest, "invalid json")
-		return
+	apply()
+	s.afterCommit()
+	return nil
+}
+
+func (s *AppState) afterCommit() {
+	s.search.sync(s.items, s.categories)
+	s.icons.sync(s.items)
+	s.links.sync(s.items)
+	s.syncVisibilityLocked()
+	s.snapshots.markDirty()
+}
+
+func (s *AppState) dataLocked() DataFile {
+	return DataFile{SchemaVersion: currentSchemaVersion, NextID: s.nextID, Categories: s.categories, Items: s.items, Admin: s.admin, Trash: s.trash}
+}
+
+func (s *AppState) handleGetData(w http.ResponseWriter, r *http.Request) {
+	_, admin := s.sessionUserFor(r)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data := s.dataLocked()
+	data.Admin = AdminAuth{Username: s.admin.Username}
+	data.Trash = nil
+	if !admin {
+		data.Categories, data.Items = publicData(data.Categories, data.Items)
 	}
-	if data.NextID == 0 {
-		data.NextID = 1
+	w.Header().Set("Vary", "Cookie")
+	if tags := tagFilter(r); len(tags) > 0 {
+		data.Items = filterItemsByTags(data.Items, tags)
 	}
-	if data.Admin.Username == "" || data.Admin.PasswordHash == "" {
-		data.Admin = defaultAdmin()
+	switch r.URL.Query().Get("shape") {
+	case "", "flat":
+		writeJSONWithETag(w, r, data)
+	case "tree":
+		writeJSONWithETag(w, r, struct {
+			DataFile
+			Tree []categoryNode `json:"tree"`
+		}{data, buildCategoryTree(data.Categories)})
+	default:
+		writeText(w, http.StatusBadRequest, "invalid shape")
 	}
+}
 
-	s.mu.Lock()
-	s.nextID = data.NextID
-	s.items = data.Items
-	s.categories = data.Categories
-	s.admin = data.Admin
-	err = s.save()
-	s.mu.Unlock()
+func (s *AppState) dataETagLocked() string {
+	data := s.dataLocked()
+	data.Admin = AdminAuth{Username: s.admin.Username}
+	data.Trash = nil
+	payload, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
-		writeText(w, http.StatusInternalServerError, "save failed")
-		return
+		return ""
 	}
-	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+	return contentETag(append(payload, '\n'))
 }
 
 func (s *AppState) handleCreateItem(w http.ResponseWriter, r *http.Request) {
@@ -411,24 +689,73 @@ func (s *AppState) handleCreateItem(w http.ResponseWriter, r *http.Request) {
 		writeText(w, http.StatusBadRequest, "invalid json")
 		return
 	}
+	enrich, ok := queryBool(r.URL.Query(), "enrich", false)
+	if !ok {
+		writeText(w, http.StatusBadRequest, "invalid enrich flag")
+		return
+	}
+	placeholder := false
+	if enrich && strings.TrimSpace(req.Name) == "" && validImportURL(req.URL) {
+		req.Name = urlHost(req.URL)
+		placeholder = true
+	}
 	if strings.TrimSpace(req.Name) == "" || strings.TrimSpace(req.URL) == "" {
 		writeText(w, http.StatusBadRequest, "name and url required")
 		return
 	}
+	if req.Tags, err = normalizeTags(req.Tags); err != nil {
+		writeText(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Alias, err = normalizeAlias(req.Alias, req.URL); err != nil {
+		writeText(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Visibility, err = normalizeVisibility(req.Visibility); err != nil {
+		writeText(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	s.mu.Lock()
+	if req.CategoryID != nil && !s.categoryExistsLocked(*req.CategoryID) {
+		s.mu.Unlock()
+		writeText(w, http.StatusBadRequest, "unknown category")
+		return
+	}
+	if aliasTaken(s.items, req.Alias, 0) {
+		s.mu.Unlock()
+		writeText(w, http.StatusConflict, errAliasInUse.Error())
+		return
+	}
 	req.ID = s.nextID
-	s.nextID++
-	s.items = append(s.items, req)
-	err = s.save()
+	req.Rev = 1
+	err = s.commit(func(tx StoreTx) error {
+		if err := tx.PutItem(req); err != nil {
+			return err
+		}
+		return tx.SetNextID(req.ID + 1)
+	}, func() {
+		s.nextID++
+		s.items = append(s.items, req)
+		s.audit(r, "item.create", itemTarget(req.ID), nil, req)
+		s.events.publish("item.created", req)
+	})
 	s.mu.Unlock()
 	if err != nil {
-		writeText(w, http.StatusInternalServerError, "save failed")
+		writeSaveError(w, err)
 		return
 	}
+	if enrich && validImportURL(req.URL) {
+		if job := s.newEnrichJob(r, req, placeholder); !job.empty() {
+			s.enqueueEnrich(job)
+		}
+	}
+	w.Header().Set("ETag", itemETag(req))
 	writeJSON(w, http.StatusCreated, req)
 }
 
+// handleUpdateItem replaces an item. Tags and alias left out of the body
+// keep their stored value; a kept alias must still fit the new URL.
 func (s *AppState) handleUpdateItem(w http.ResponseWriter, r *http.Request, id uint32) {
 	body, err := readBody(r, 512*1024)
 	if err != nil {
@@ -444,54 +771,126 @@ func (s *AppState) handleUpdateItem(w http.ResponseWriter, r *http.Request, id u
 		writeText(w, http.StatusBadRequest, "name and url required")
 		return
 	}
+	if req.Tags, err = normalizeTags(req.Tags); err != nil {
+		writeText(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Alias, err = normalizeAlias(req.Alias, req.URL); err != nil {
+		writeText(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Visibility, err = normalizeVisibility(req.Visibility); err != nil {
+		writeText(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	fields := bodyFields(body)
 
 	s.mu.Lock()
 	updated := false
+	stale := false
+	taken := false
+	unknownCategory := false
+	var invalid error
 	for i := range s.items {
 		if s.items[i].ID == id {
+			if !ifMatch(r, itemETag(s.items[i])) {
+				stale = true
+				break
+			}
+			if req.CategoryID != nil && !s.categoryExistsLocked(*req.CategoryID) {
+				unknownCategory = true
+				break
+			}
+			if !fields["alias"] {
+				if req.Alias, invalid = normalizeAlias(s.items[i].Alias, req.URL); invalid != nil {
+					break
+				}
+			}
+			if aliasTaken(s.items, req.Alias, id) {
+				taken = true
+				break
+			}
+			if !fields["tags"] {
+				req.Tags = s.items[i].Tags
+			}
 			req.ID = id
-			s.items[i] = req
+			req.Rev = s.items[i].Rev + 1
+			err = s.commit(func(tx StoreTx) error {
+				return tx.PutItem(req)
+			}, func() {
+				s.audit(r, "item.update", itemTarget(id), s.items[i], req)
+				s.items[i] = req
+				s.events.publish("item.updated", req)
+			})
 			updated = true
 			break
 		}
 	}
-	if updated {
-		err = s.save()
-	}
 	s.mu.Unlock()
 
+	if stale {
+		writeText(w, http.StatusPreconditionFailed, "precondition failed")
+		return
+	}
+	if unknownCategory {
+		writeText(w, http.StatusBadRequest, "unknown category")
+		return
+	}
+	if invalid != nil {
+		writeText(w, http.StatusBadRequest, invalid.Error())
+		return
+	}
+	if taken {
+		writeText(w, http.StatusConflict, errAliasInUse.Error())
+		return
+	}
 	if !updated {
 		writeText(w, http.StatusNotFound, "not found")
 		return
 	}
 	if err != nil {
-		writeText(w, http.StatusInternalServerError, "save failed")
+		writeSaveError(w, err)
 		return
 	}
+	w.Header().Set("ETag", itemETag(req))
 	writeJSON(w, http.StatusOK, req)
 }
 
-func (s *AppState) handleDeleteItem(w http.ResponseWriter, id uint32) {
+func (s *AppState) handleDeleteItem(w http.ResponseWriter, r *http.Request, id uint32) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	removed := false
-	filtered := s.items[:0]
+	var removed *Item
+	filtered := make([]Item, 0, len(s.items))
 	for _, item := range s.items {
 		if item.ID == id {
-			removed = true
+			if !ifMatch(r, itemETag(item)) {
+				writeText(w, http.StatusPreconditionFailed, "precondition failed")
+				return
+			}
+			removed = &item
 			continue
 		}
 		filtered = append(filtered, item)
 	}
-	if !removed {
+	if removed == nil {
 		writeText(w, http.StatusNotFound, "not found")
 		return
 	}
-	s.items = filtered
 
-	if err := s.save(); err != nil {
-		writeText(w, http.StatusInternalServerError, "save failed")
+	entry := TrashEntry{ID: id, Kind: trashKindItem, DeletedAt: time.Now().UTC(), DeletedBy: sessionUser(r), Item: removed}
+	if err := s.commit(func(tx StoreTx) error {
+		if err := tx.DeleteItem(id); err != nil {
+			return err
+		}
+		return tx.PutTrash(entry)
+	}, func() {
+		s.audit(r, "item.delete", itemTarget(id), *removed, nil)
+		s.items = filtered
+		s.trash = append(s.trash, entry)
+		s.events.publish("item.deleted", map[string]uint32{"id": id})
+	}); err != nil {
+		writeSaveError(w, err)
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
@@ -512,20 +911,41 @@ func (s *AppState) handleCreateCategory(w http.ResponseWriter, r *http.Request)
 		writeText(w, http.StatusBadRequest, "name required")
 		return
 	}
+	if req.Visibility, err = normalizeVisibility(req.Visibility); err != nil {
+		writeText(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	s.mu.Lock()
+	if msg := s.checkParentLocked(0, req.ParentID); msg != "" {
+		s.mu.Unlock()
+		writeText(w, http.StatusBadRequest, msg)
+		return
+	}
 	req.ID = s.nextID
-	s.nextID++
-	s.categories = append(s.categories, req)
-	err = s.save()
+	req.Rev = 1
+	err = s.commit(func(tx StoreTx) error {
+		if err := tx.PutCategory(req); err != nil {
+			return err
+		}
+		return tx.SetNextID(req.ID + 1)
+	}, func() {
+		s.nextID++
+		s.categories = append(s.categories, req)
+		s.audit(r, "category.create", categoryTarget(req.ID), nil, req)
+		s.events.publish("category.created", req)
+	})
 	s.mu.Unlock()
 	if err != nil {
-		writeText(w, http.StatusInternalServerError, "save failed")
+		writeSaveError(w, err)
 		return
 	}
+	w.Header().Set("ETag", categoryETag(req))
 	writeJSON(w, http.StatusCreated, req)
 }
 
+// handleUpdateCategory replaces a category. Without a parent_id field the
+// category stays where it is; "parent_id": null moves it to the top level.
 func (s *AppState) handleUpdateCategory(w http.ResponseWriter, r *http.Request, id uint32) {
 	body, err := readBody(r, 128*1024)
 	if err != nil {
@@ -541,60 +961,136 @@ func (s *AppState) handleUpdateCategory(w http.ResponseWriter, r *http.Request,
 		writeText(w, http.StatusBadRequest, "name required")
 		return
 	}
+	if req.Visibility, err = normalizeVisibility(req.Visibility); err != nil {
+		writeText(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	fields := bodyFields(body)
 
 	s.mu.Lock()
 	updated := false
+	stale := false
+	invalid := ""
 	for i := range s.categories {
 		if s.categories[i].ID == id {
+			if !ifMatch(r, categoryETag(s.categories[i])) {
+				stale = true
+				break
+			}
+			if !fields["parent_id"] {
+				req.ParentID = s.categories[i].ParentID
+			}
+			if invalid = s.checkParentLocked(id, req.ParentID); invalid != "" {
+				break
+			}
 			req.ID = id
-			s.categories[i] = req
+			req.Rev = s.categories[i].Rev + 1
+			err = s.commit(func(tx StoreTx) error {
+				return tx.PutCategory(req)
+			}, func() {
+				s.audit(r, "category.update", categoryTarget(id), s.categories[i], req)
+				s.categories[i] = req
+				s.events.publish("category.updated", req)
+			})
 			updated = true
 			break
 		}
 	}
-	if updated {
-		err = s.save()
-	}
 	s.mu.Unlock()
 
+	if stale {
+		writeText(w, http.StatusPreconditionFailed, "precondition failed")
+		return
+	}
+	if invalid != "" {
+		writeText(w, http.StatusBadRequest, invalid)
+		return
+	}
 	if !updated {
 		writeText(w, http.StatusNotFound, "not found")
 		return
 	}
 	if err != nil {
-		writeText(w, http.StatusInternalServerError, "save failed")
+		writeSaveError(w, err)
 		return
 	}
+	w.Header().Set("ETag", categoryETag(req))
 	writeJSON(w, http.StatusOK, req)
 }
 
-func (s *AppState) handleDeleteCategory(w http.ResponseWriter, id uint32) {
+func (s *AppState) handleDeleteCategory(w http.ResponseWriter, r *http.Request, id uint32) {
+	children, ok := parseDeleteChildren(r.URL.Query().Get("children"))
+	if !ok {
+		writeText(w, http.StatusBadRequest, "invalid children mode")
+		return
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	filtered := s.categories[:0]
-	removed := false
+	var removed *Category
 	for _, cat := range s.categories {
 		if cat.ID == id {
-			removed = true
-			continue
+			if !ifMatch(r, categoryETag(cat)) {
+				writeText(w, http.StatusPreconditionFailed, "precondition failed")
+				return
+			}
+			removed = &cat
+			break
 		}
-		filtered = append(filtered, cat)
 	}
-	if !removed {
+	if removed == nil {
 		writeText(w, http.StatusNotFound, "not found")
 		return
 	}
-	s.categories = filtered
-
-	for i := range s.items {
-		if s.items[i].CategoryID != nil && *s.items[i].CategoryID == id {
-			s.items[i].CategoryID = nil
-		}
+	del, ok := planCategoryDeletion(s.categories, s.items, *removed, children, sessionUser(r), time.Now().UTC())
+	if !ok {
+		writeText(w, http.StatusConflict, "category has subcategories")
+		return
 	}
-
-	if err := s.save(); err != nil {
-		writeText(w, http.StatusInternalServerError, "save failed")
+	err := s.commit(func(tx StoreTx) error {
+		for _, cat := range del.trashed {
+			if err := tx.DeleteCategory(cat.ID); err != nil {
+				return err
+			}
+		}
+		for _, cat := range del.reparented {
+			if err := tx.PutCategory(cat); err != nil {
+				return err
+			}
+		}
+		for _, item := range del.detached {
+			if err := tx.PutItem(item); err != nil {
+				return err
+			}
+		}
+		for _, entry := range del.entries {
+			if err := tx.PutTrash(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func() {
+		s.audit(r, "category.delete", categoryTarget(id), *removed, map[string][]uint32{
+			"detached_items":        del.detachedIDs,
+			"deleted_subcategories": del.subtree,
+			"reparented_children":   del.reparentedIDs,
+		})
+		s.categories = del.categories
+		s.items = del.items
+		s.trash = append(s.trash, del.entries...)
+		for _, cat := range del.trashed {
+			s.events.publish("category.deleted", map[string]uint32{"id": cat.ID})
+		}
+		for _, cat := range del.reparented {
+			s.events.publish("category.updated", cat)
+		}
+		for _, item := range del.detached {
+			s.events.publish("item.updated", item)
+		}
+	})
+	if err != nil {
+		writeSaveError(w, err)
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
@@ -620,6 +1116,7 @@ func (s *AppState) handleLogin(w http.ResponseWriter, r *http.Request) {
 	s.mu.Unlock()
 
 	if req.Username != admin.Username || !constantTimeEquals(hashPassword(req.Password), admin.PasswordHash) {
+		s.audit(withSessionUser(r, req.Username), "login.failed", "", nil, nil)
 		writeText(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
@@ -632,8 +1129,16 @@ func (s *AppState) handleLogin(w http.ResponseWriter, r *http.Request) {
 	session := hex.EncodeToString(token)
 
 	s.mu.Lock()
-	s.sessions[session] = admin.Username
+	err = s.store.SaveSession(session, admin.Username)
+	if err == nil {
+		s.sessions[session] = admin.Username
+	}
 	s.mu.Unlock()
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	s.audit(withSessionUser(r, admin.Username), "login", "", nil, nil)
 
 	http.SetCookie(w, &http.Cookie{
 		Name:     "nav_session",
@@ -645,7 +1150,17 @@ func (s *AppState) handleLogin(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
 }
 
-func (s *AppState) handleLogout(w http.ResponseWriter) {
+func (s *AppState) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie("nav_session"); err == nil && cookie.Value != "" {
+		s.mu.Lock()
+		user, ok := s.sessions[cookie.Value]
+		delete(s.sessions, cookie.Value)
+		_ = s.store.DeleteSession(cookie.Value)
+		s.mu.Unlock()
+		if ok {
+			s.audit(withSessionUser(r, user), "logout", "", nil, nil)
+		}
+	}
 	cookie := &http.Cookie{
 		Name:     "nav_session",
 		Value:    "",
@@ -683,11 +1198,17 @@ func (s *AppState) handleChangePassword(w http.ResponseWriter, r *http.Request)
 		writeText(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
-	s.admin.PasswordHash = hashPassword(req.NewPassword)
-	err = s.save()
+	admin := s.admin
+	admin.PasswordHash = hashPassword(req.NewPassword)
+	err = s.commit(func(tx StoreTx) error {
+		return tx.SetAdmin(admin)
+	}, func() {
+		s.audit(r, "password.change", "", nil, nil)
+		s.admin = admin
+	})
 	s.mu.Unlock()
 	if err != nil {
-		writeText(w, http.StatusInternalServerError, "save failed")
+		writeSaveError(w, err)
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
@@ -0,0 +1,135 @@
+package nav
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testClient drives an App through its handler, logged in as the default
+// admin.
+type testClient struct {
+	t      *testing.T
+	app    *App
+	h      http.Handler
+	cookie *http.Cookie
+}
+
+func newTestClient(t *testing.T) *testClient {
+	t.Helper()
+	// Not t.TempDir: the app's background workers may still write to the
+	// directory while it is removed.
+	dir, err := os.MkdirTemp("", "nav-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	app, err := New(Config{DataPath: filepath.Join(dir, "data.json")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &testClient{t: t, app: app, h: app.Handler()}
+	w := c.do("POST", "/api/login", `{"username":"admin","password":"admin"}`)
+	if w.Code != http.StatusOK || len(w.Result().Cookies()) == 0 {
+		t.Fatalf("login: %d %s", w.Code, w.Body)
+	}
+	c.cookie = w.Result().Cookies()[0]
+	return c
+}
+
+func (c *testClient) do(method, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if c.cookie != nil {
+		r.AddCookie(c.cookie)
+	}
+	w := httptest.NewRecorder()
+	c.h.ServeHTTP(w, r)
+	return w
+}
+
+func (c *testClient) decode(w *httptest.ResponseRecorder, v any) {
+	c.t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		c.t.Fatalf("decode %q: %v", w.Body, err)
+	}
+}
+
+func TestUpdateItemKeepsOmittedTags(t *testing.T) {
+	c := newTestClient(t)
+	var item Item
+	c.decode(c.do("POST", "/api/item", `{"name":"a","url":"https://a.invalid/","tags":["x","y"]}`), &item)
+
+	w := c.do("PUT", fmt.Sprintf("/api/item/%d", item.ID), `{"name":"b","url":"https://a.invalid/"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body)
+	}
+	c.decode(w, &item)
+	if !slices.Equal(item.Tags, []string{"x", "y"}) {
+		t.Fatalf("tags after update without tags: got %v", item.Tags)
+	}
+
+	var cleared Item
+	c.decode(c.do("PUT", fmt.Sprintf("/api/item/%d", item.ID), `{"name":"b","url":"https://a.invalid/","tags":[]}`), &cleared)
+	if len(cleared.Tags) != 0 {
+		t.Fatalf("tags after update with empty tags: got %v", cleared.Tags)
+	}
+}
+
+func TestUpdateItemKeepsOmittedAlias(t *testing.T) {
+	c := newTestClient(t)
+	var item Item
+	c.decode(c.do("POST", "/api/item", `{"name":"a","url":"https://a.invalid/{n}","alias":"a/{n}"}`), &item)
+	path := fmt.Sprintf("/api/item/%d", item.ID)
+
+	var updated Item
+	c.decode(c.do("PUT", path, `{"name":"b","url":"https://b.invalid/{n}"}`), &updated)
+	if updated.Alias != "a/{n}" {
+		t.Fatalf("alias after update without alias: got %q", updated.Alias)
+	}
+	if w := c.do("PUT", path, `{"name":"b","url":"https://b.invalid/"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("kept alias not fitting the new url: got %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	var cleared Item
+	c.decode(c.do("PUT", path, `{"name":"b","url":"https://b.invalid/","alias":""}`), &cleared)
+	if cleared.Alias != "" {
+		t.Fatalf("alias after update with empty alias: got %q", cleared.Alias)
+	}
+}
+
+func TestUpdateCategoryKeepsOmittedParent(t *testing.T) {
+	c := newTestClient(t)
+	var parent, child Category
+	c.decode(c.do("POST", "/api/category", `{"name":"parent"}`), &parent)
+	c.decode(c.do("POST", "/api/category", fmt.Sprintf(`{"name":"child","parent_id":%d}`, parent.ID)), &child)
+	path := fmt.Sprintf("/api/category/%d", child.ID)
+
+	var updated Category
+	c.decode(c.do("PUT", path, `{"name":"renamed"}`), &updated)
+	if updated.ParentID == nil || *updated.ParentID != parent.ID {
+		t.Fatalf("parent after update without parent_id: got %v, want %d", updated.ParentID, parent.ID)
+	}
+	var moved Category
+	c.decode(c.do("PUT", path, `{"name":"renamed","parent_id":null}`), &moved)
+	if moved.ParentID != nil {
+		t.Fatalf("parent after update with null parent_id: got %d", *moved.ParentID)
+	}
+}
+
+func TestItemUnknownCategory(t *testing.T) {
+	c := newTestClient(t)
+	if w := c.do("POST", "/api/item", `{"name":"a","url":"https://a.invalid/","category_id":99}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("create with unknown category: got %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	var item Item
+	c.decode(c.do("POST", "/api/item", `{"name":"a","url":"https://a.invalid/"}`), &item)
+	w := c.do("PUT", fmt.Sprintf("/api/item/%d", item.ID), `{"name":"a","url":"https://a.invalid/","category_id":99}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("update with unknown category: got %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,319 @@
+package nav
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+type AuditEntry struct {
+	ID     uint64    `json:"id"`
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	IP     string    `json:"ip"`
+	Action string    `json:"action"`
+	Target string    `json:"target,omitempty"`
+	Before any       `json:"before,omitempty"`
+	After  any       `json:"after,omitempty"`
+}
+
+// auditLog appends entries as JSON lines to a file next to the nav data.
+type auditLog struct {
+	mu     sync.Mutex
+	path   string
+	nextID uint64
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	a := &auditLog{path: path, nextID: 1}
+	err := a.scan(func(e AuditEntry) bool {
+		if e.ID >= a.nextID {
+			a.nextID = e.ID + 1
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("open audit log %s: %w", path, err)
+	}
+	return a, nil
+}
+
+func (a *auditLog) append(e AuditEntry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	e.ID = a.nextID
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	a.nextID++
+	return nil
+}
+
+// scan calls fn for every entry in file order until fn returns false.
+// Lines that cannot be decoded (e.g. a torn final write) are skipped.
+func (a *auditLog) scan(fn func(AuditEntry) bool) error {
+	f, err := os.Open(a.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			continue
+		}
+		if !fn(e) {
+			return nil
+		}
+	}
+	return sc.Err()
+}
+
+type auditFilter struct {
+	action string
+	user   string
+	target string
+	since  time.Time
+	until  time.Time
+}
+
+func (f auditFilter) match(e AuditEntry) bool {
+	if f.action != "" && e.Action != f.action && !strings.HasPrefix(e.Action, f.action+".") {
+		return false
+	}
+	if f.user != "" && e.User != f.user {
+		return false
+	}
+	if f.target != "" && e.Target != f.target {
+		return false
+	}
+	if !f.since.IsZero() && e.Time.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && !e.Time.Before(f.until) {
+		return false
+	}
+	return true
+}
+
+// query returns the matching entries newest first, with the total count.
+func (a *auditLog) query(filter auditFilter, offset, limit int) ([]AuditEntry, int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var matched []AuditEntry
+	err := a.scan(func(e AuditEntry) bool {
+		if filter.match(e) {
+			matched = append(matched, e)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	total := len(matched)
+	out := []AuditEntry{}
+	for i := total - 1 - offset; i >= 0 && len(out) < limit; i-- {
+		out = append(out, matched[i])
+	}
+	return out, total, nil
+}
+
+type sessionUserKey struct{}
+
+func withSessionUser(r *http.Request, user string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), sessionUserKey{}, user))
+}
+
+func sessionUser(r *http.Request) string {
+	user, _ := r.Context().Value(sessionUserKey{}).(string)
+	return user
+}
+
+// parseTrustedProxies reads proxy addresses, each an IP or a CIDR range.
+func parseTrustedProxies(list []string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, v := range list {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if p, err := netip.ParsePrefix(v); err == nil {
+			out = append(out, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", v)
+		}
+		out = append(out, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return out, nil
+}
+
+func (s *AppState) trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range s.trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the connection's remote address. Only when that is a
+// configured trusted proxy are X-Real-IP and X-Forwarded-For believed; the
+// latter is read from the right, skipping further trusted proxies, since
+// anything to the left of them may have been sent by the client.
+func (s *AppState) clientIP(r *http.Request) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	if !s.trustedProxy(peer) {
+		return peer
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(hops[i])
+		if ip != "" && !s.trustedProxy(ip) {
+			return ip
+		}
+	}
+	return peer
+}
+
+// audit records an admin action. A failure to write the log is reported
+// but does not undo the action.
+func (s *AppState) audit(r *http.Request, action, target string, before, after any) {
+	s.auditAs(sessionUser(r), s.clientIP(r), action, target, before, after)
+}
+
+// auditAs records an action on behalf of a user outside of a request, as
+// background work started by one does.
+func (s *AppState) auditAs(user, ip, action, target string, before, after any) {
+	if s.auditLog == nil {
+		return
+	}
+	e := AuditEntry{
+		Time:   time.Now().UTC(),
+		User:   user,
+		IP:     ip,
+		Action: action,
+		Target: target,
+		Before: before,
+		After:  after,
+	}
+	if err := s.auditLog.append(e); err != nil {
+		log.Printf("nav: audit %s failed: %v", action, err)
+	}
+}
+
+func dataSummary(data DataFile) map[string]int {
+	return map[string]int{"categories": len(data.Categories), "items": len(data.Items)}
+}
+
+func itemTarget(id uint32) string {
+	return "item:" + strconv.FormatUint(uint64(id), 10)
+}
+
+func categoryTarget(id uint32) string {
+	return "category:" + strconv.FormatUint(uint64(id), 10)
+}
+
+func (s *AppState) handleAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := auditFilter{
+		action: q.Get("action"),
+		user:   q.Get("user"),
+		target: q.Get("target"),
+	}
+	for key, dst := range map[string]*time.Time{"since": &filter.since, "until": &filter.until} {
+		if v := q.Get(key); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeText(w, http.StatusBadRequest, "invalid "+key)
+				return
+			}
+			*dst = t
+		}
+	}
+	offset, limit, ok := parsePaging(w, r, defaultAuditLimit, maxAuditLimit)
+	if !ok {
+		return
+	}
+
+	entries, total, err := s.auditLog.query(filter, offset, limit)
+	if err != nil {
+		writeText(w, http.StatusInternalServerError, "read audit log failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"total":   total,
+		"offset":  offset,
+		"limit":   limit,
+		"entries": entries,
+	})
+}
+
+// parsePaging reads offset and limit query parameters, writing a 400 and
+// returning ok=false when they are invalid.
+func parsePaging(w http.ResponseWriter, r *http.Request, defaultLimit, maxLimit int) (offset, limit int, ok bool) {
+	q := r.URL.Query()
+	limit = defaultLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeText(w, http.StatusBadRequest, "invalid limit")
+			return 0, 0, false
+		}
+		limit = min(n, maxLimit)
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeText(w, http.StatusBadRequest, "invalid offset")
+			return 0, 0, false
+		}
+		offset = n
+	}
+	return offset, limit, true
+}
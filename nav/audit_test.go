@@ -0,0 +1,39 @@
+package nav
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := parseTrustedProxies([]string{"10.0.0.1", " 192.168.0.0/16 ", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &AppState{trustedProxies: proxies}
+	tests := []struct {
+		remote, realIP, forwarded, want string
+	}{
+		{"203.0.113.9:1234", "1.2.3.4", "5.6.7.8", "203.0.113.9"},
+		{"10.0.0.1:1234", "1.2.3.4", "5.6.7.8", "1.2.3.4"},
+		{"10.0.0.1:1234", "", "6.6.6.6, 5.6.7.8, 192.168.1.1", "5.6.7.8"},
+		{"10.0.0.1:1234", "", "", "10.0.0.1"},
+		{"[::ffff:10.0.0.1]:1234", "", "5.6.7.8", "5.6.7.8"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if got := s.clientIP(r); got != tt.want {
+			t.Errorf("%+v: got %s", tt, got)
+		}
+	}
+	if _, err := parseTrustedProxies([]string{"proxy.local"}); err == nil {
+		t.Error("hostname accepted as trusted proxy")
+	}
+}
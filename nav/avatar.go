@@ -0,0 +1,144 @@
+package nav
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const avatarSize = 64
+
+var avatarPalette = []string{
+	"#e57373", "#f06292", "#ba68c8", "#9575cd", "#7986cb", "#64b5f6",
+	"#4fc3f7", "#4dd0e1", "#4db6ac", "#81c784", "#ffb74d", "#a1887f",
+}
+
+// monogram picks the letters shown on a generated avatar: up to two
+// initials for Latin, Greek and Cyrillic names ("Google Drive" -> "GD"),
+// otherwise the first character, keeping emoji sequences (skin tones,
+// ZWJ sequences, flags, keycaps) whole. Leading spaces and punctuation are
+// skipped.
+func monogram(text string) string {
+	for text != "" {
+		r, size := utf8.DecodeRuneInString(text)
+		next, _ := utf8.DecodeRuneInString(text[size:])
+		keycap := next == 0xfe0f || next == 0x20e3
+		if !unicode.IsSpace(r) && !(unicode.IsPunct(r) && !keycap) {
+			break
+		}
+		text = text[size:]
+	}
+	if text == "" {
+		return "?"
+	}
+	first, _ := utf8.DecodeRuneInString(text)
+	if !initialsScript(first) {
+		return firstGrapheme(text)
+	}
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.Is(unicode.Mn, r)
+	})
+	var out strings.Builder
+	for i, word := range words {
+		r, size := utf8.DecodeRuneInString(word)
+		if i == 2 || !initialsScript(r) {
+			break
+		}
+		out.WriteRune(unicode.ToUpper(r))
+		out.WriteString(firstGrapheme(word)[size:])
+	}
+	return out.String()
+}
+
+func initialsScript(r rune) bool {
+	return unicode.IsDigit(r) || unicode.In(r, unicode.Latin, unicode.Greek, unicode.Cyrillic)
+}
+
+// firstGrapheme returns the first user-perceived character of s. It
+// covers the emoji sequences and combining marks found in names without
+// pulling in full grapheme segmentation.
+func firstGrapheme(s string) string {
+	runes := []rune(s)
+	if len(runes) > 32 {
+		runes = runes[:32]
+	}
+	i := 1
+	if isRegionalIndicator(runes[0]) && len(runes) > 1 && isRegionalIndicator(runes[1]) {
+		i = 2
+	}
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case r == 0x200d && i+1 < len(runes):
+			i += 2
+		case r == 0xfe0e || r == 0xfe0f || r == 0x20e3,
+			r >= 0x1f3fb && r <= 0x1f3ff,
+			r >= 0xe0020 && r <= 0xe007f,
+			unicode.In(r, unicode.Mn, unicode.Me):
+			i++
+		default:
+			return string(runes[:i])
+		}
+	}
+	return string(runes[:i])
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
+
+// avatarColor derives the background from seed, falling back to text, so
+// the same site always gets the same colour.
+func avatarColor(text, seed string) string {
+	if seed == "" {
+		seed = text
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(seed))
+	return avatarPalette[h.Sum32()%uint32(len(avatarPalette))]
+}
+
+// avatarSVG renders a rounded square with the monogram of text.
+func avatarSVG(text, seed string) []byte {
+	mark := monogram(text)
+	fontSize := 32
+	if first, _ := utf8.DecodeRuneInString(mark); initialsScript(first) && mark != firstGrapheme(mark) {
+		fontSize = 26
+	}
+	return []byte(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="%[1]d" viewBox="0 0 %[1]d %[1]d" role="img" aria-label="%[2]s">`+
+		`<rect width="%[1]d" height="%[1]d" rx="12" fill="%[3]s"/>`+
+		`<text x="50%%" y="50%%" dominant-baseline="central" text-anchor="middle" fill="#fff" font-size="%[4]d" font-weight="600" `+
+		`font-family="-apple-system, 'Segoe UI', 'PingFang SC', 'Microsoft YaHei', 'Noto Sans CJK SC', sans-serif, 'Apple Color Emoji', 'Segoe UI Emoji', 'Noto Color Emoji'">%[5]s</text></svg>`,
+		avatarSize, html.EscapeString(strings.TrimSpace(text)), avatarColor(text, seed), fontSize, html.EscapeString(mark)))
+}
+
+// writeAvatar serves an SVG avatar with a content-hash ETag.
+func writeAvatar(w http.ResponseWriter, r *http.Request, payload []byte, cacheControl string) {
+	etag := contentETag(payload)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if ifNoneMatch(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(payload)
+}
+
+// handleAvatar renders /api/avatar.svg?text=&seed=. The image depends only
+// on the query, so it may be cached for a year.
+func (s *AppState) handleAvatar(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	text := q.Get("text")
+	if utf8.RuneCountInString(text) > 256 {
+		text = string([]rune(text)[:256])
+	}
+	writeAvatar(w, r, avatarSVG(text, q.Get("seed")), "public, max-age=31536000, immutable")
+}
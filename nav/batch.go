@@ -0,0 +1,444 @@
+package nav
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const maxBatchOps = 1000
+
+// batchOp is one operation of POST /api/batch. Records created earlier in
+// the batch can be named with Ref and then targeted with IDRef, or used as
+// category (CategoryRef) or parent (ParentRef).
+type batchOp struct {
+	Op          string          `json:"op"`
+	Type        string          `json:"type"`
+	ID          uint32          `json:"id,omitempty"`
+	IDRef       string          `json:"id_ref,omitempty"`
+	Ref         string          `json:"ref,omitempty"`
+	IfMatch     string          `json:"if_match,omitempty"`
+	Data        json.RawMessage `json:"data,omitempty"`
+	CategoryID  *uint32         `json:"category_id,omitempty"`
+	CategoryRef string          `json:"category_ref,omitempty"`
+	ParentID    *uint32         `json:"parent_id,omitempty"`
+	ParentRef   string          `json:"parent_ref,omitempty"`
+	Order       *int32          `json:"order,omitempty"`
+	Children    string          `json:"children,omitempty"`
+}
+
+type batchResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	Type   string `json:"type"`
+	ID     uint32 `json:"id"`
+	Ref    string `json:"ref,omitempty"`
+	ETag   string `json:"etag,omitempty"`
+	Record any    `json:"record,omitempty"`
+}
+
+type batchError struct {
+	status int
+	msg    string
+}
+
+func (e *batchError) Error() string { return e.msg }
+
+func batchFail(status int, format string, args ...any) error {
+	return &batchError{status: status, msg: fmt.Sprintf(format, args...)}
+}
+
+type batchAudit struct {
+	action, target string
+	before, after  any
+}
+
+type batchEvent struct {
+	typ  string
+	data any
+}
+
+// batchState applies operations to a working copy of the data so that a
+// failing operation leaves the live state untouched.
+type batchState struct {
+	nextID     uint32
+	categories []Category
+	items      []Item
+	trash      []TrashEntry
+	refs       map[string]uint32
+	user       string
+	now        time.Time
+	audits     []batchAudit
+	events     []batchEvent
+}
+
+func (b *batchState) resolve(id uint32, ref string) (uint32, error) {
+	if ref == "" {
+		return id, nil
+	}
+	v, ok := b.refs[ref]
+	if !ok {
+		return 0, batchFail(http.StatusBadRequest, "unknown ref %q", ref)
+	}
+	return v, nil
+}
+
+func (b *batchState) resolveOptional(id *uint32, ref string) (*uint32, error) {
+	if ref == "" {
+		return id, nil
+	}
+	v, err := b.resolve(0, ref)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (b *batchState) itemIndex(id uint32) int {
+	for i := range b.items {
+		if b.items[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (b *batchState) categoryIndex(id uint32) int {
+	for i := range b.categories {
+		if b.categories[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (b *batchState) checkItem(item *Item, id uint32) error {
+	if strings.TrimSpace(item.Name) == "" || strings.TrimSpace(item.URL) == "" {
+		return batchFail(http.StatusBadRequest, "name and url required")
+	}
+	tags, err := normalizeTags(item.Tags)
+	if err != nil {
+		return batchFail(http.StatusBadRequest, "%s", err)
+	}
+	item.Tags = tags
+	alias, err := normalizeAlias(item.Alias, item.URL)
+	if err != nil {
+		return batchFail(http.StatusBadRequest, "%s", err)
+	}
+	if aliasTaken(b.items, alias, id) {
+		return batchFail(http.StatusConflict, "%s", errAliasInUse)
+	}
+	item.Alias = alias
+	if item.Visibility, err = normalizeVisibility(item.Visibility); err != nil {
+		return batchFail(http.StatusBadRequest, "%s", err)
+	}
+	if item.CategoryID != nil && b.categoryIndex(*item.CategoryID) < 0 {
+		return batchFail(http.StatusBadRequest, "unknown category")
+	}
+	return nil
+}
+
+func (b *batchState) apply(op batchOp) (batchResult, error) {
+	res := batchResult{Op: op.Op, Type: op.Type, Ref: op.Ref}
+	if op.Op != "create" {
+		id, err := b.resolve(op.ID, op.IDRef)
+		if err != nil {
+			return res, err
+		}
+		res.ID = id
+	}
+	var err error
+	switch op.Type {
+	case "item":
+		err = b.applyItem(op, &res)
+	case "category":
+		err = b.applyCategory(op, &res)
+	default:
+		err = batchFail(http.StatusBadRequest, "invalid type")
+	}
+	if err == nil && op.Ref != "" {
+		if _, dup := b.refs[op.Ref]; dup {
+			return res, batchFail(http.StatusBadRequest, "duplicate ref %q", op.Ref)
+		}
+		b.refs[op.Ref] = res.ID
+	}
+	return res, err
+}
+
+func (b *batchState) applyItem(op batchOp, res *batchResult) error {
+	i := -1
+	if op.Op != "create" {
+		if i = b.itemIndex(res.ID); i < 0 {
+			return batchFail(http.StatusNotFound, "not found")
+		}
+		if op.IfMatch != "" && op.IfMatch != "*" && op.IfMatch != itemETag(b.items[i]) {
+			return batchFail(http.StatusPreconditionFailed, "precondition failed")
+		}
+	}
+
+	switch op.Op {
+	case "create", "update":
+		var item Item
+		if err := json.Unmarshal(op.Data, &item); err != nil {
+			return batchFail(http.StatusBadRequest, "invalid json")
+		}
+		categoryID, err := b.resolveOptional(item.CategoryID, op.CategoryRef)
+		if err != nil {
+			return err
+		}
+		item.CategoryID = categoryID
+		if err := b.checkItem(&item, res.ID); err != nil {
+			return err
+		}
+		if op.Op == "create" {
+			item.ID = b.nextID
+			item.Rev = 1
+			b.nextID++
+			b.items = append(b.items, item)
+			b.audits = append(b.audits, batchAudit{"item.create", itemTarget(item.ID), nil, item})
+			b.events = append(b.events, batchEvent{"item.created", item})
+		} else {
+			item.ID = res.ID
+			item.Rev = b.items[i].Rev + 1
+			b.audits = append(b.audits, batchAudit{"item.update", itemTarget(item.ID), b.items[i], item})
+			b.events = append(b.events, batchEvent{"item.updated", item})
+			b.items[i] = item
+		}
+		res.ID, res.ETag, res.Record = item.ID, itemETag(item), item
+	case "move":
+		item := b.items[i]
+		categoryID, err := b.resolveOptional(op.CategoryID, op.CategoryRef)
+		if err != nil {
+			return err
+		}
+		if categoryID != nil && b.categoryIndex(*categoryID) < 0 {
+			return batchFail(http.StatusBadRequest, "unknown category")
+		}
+		item.CategoryID = categoryID
+		if op.Order != nil {
+			item.Order = *op.Order
+		}
+		item.Rev++
+		b.audits = append(b.audits, batchAudit{"item.move", itemTarget(item.ID), b.items[i], item})
+		b.events = append(b.events, batchEvent{"item.updated", item})
+		b.items[i] = item
+		res.ETag, res.Record = itemETag(item), item
+	case "delete":
+		item := b.items[i]
+		b.items = append(b.items[:i:i], b.items[i+1:]...)
+		b.trash = append(b.trash, TrashEntry{ID: item.ID, Kind: trashKindItem, DeletedAt: b.now, DeletedBy: b.user, Item: &item})
+		b.audits = append(b.audits, batchAudit{"item.delete", itemTarget(item.ID), item, nil})
+		b.events = append(b.events, batchEvent{"item.deleted", map[string]uint32{"id": item.ID}})
+	default:
+		return batchFail(http.StatusBadRequest, "invalid op")
+	}
+	return nil
+}
+
+func (b *batchState) applyCategory(op batchOp, res *batchResult) error {
+	i := -1
+	if op.Op != "create" {
+		if i = b.categoryIndex(res.ID); i < 0 {
+			return batchFail(http.StatusNotFound, "not found")
+		}
+		if op.IfMatch != "" && op.IfMatch != "*" && op.IfMatch != categoryETag(b.categories[i]) {
+			return batchFail(http.StatusPreconditionFailed, "precondition failed")
+		}
+	}
+
+	switch op.Op {
+	case "create", "update":
+		var cat Category
+		if err := json.Unmarshal(op.Data, &cat); err != nil {
+			return batchFail(http.StatusBadRequest, "invalid json")
+		}
+		if strings.TrimSpace(cat.Name) == "" {
+			return batchFail(http.StatusBadRequest, "name required")
+		}
+		visibility, err := normalizeVisibility(cat.Visibility)
+		if err != nil {
+			return batchFail(http.StatusBadRequest, "%s", err)
+		}
+		cat.Visibility = visibility
+		parentID, err := b.resolveOptional(cat.ParentID, op.ParentRef)
+		if err != nil {
+			return err
+		}
+		cat.ParentID = parentID
+		if msg := checkCategoryParent(b.categories, res.ID, cat.ParentID); msg != "" {
+			return batchFail(http.StatusBadRequest, "%s", msg)
+		}
+		if op.Op == "create" {
+			cat.ID = b.nextID
+			cat.Rev = 1
+			b.nextID++
+			b.categories = append(b.categories, cat)
+			b.audits = append(b.audits, batchAudit{"category.create", categoryTarget(cat.ID), nil, cat})
+			b.events = append(b.events, batchEvent{"category.created", cat})
+		} else {
+			cat.ID = res.ID
+			cat.Rev = b.categories[i].Rev + 1
+			b.audits = append(b.audits, batchAudit{"category.update", categoryTarget(cat.ID), b.categories[i], cat})
+			b.events = append(b.events, batchEvent{"category.updated", cat})
+			b.categories[i] = cat
+		}
+		res.ID, res.ETag, res.Record = cat.ID, categoryETag(cat), cat
+	case "move":
+		cat := b.categories[i]
+		parentID, err := b.resolveOptional(op.ParentID, op.ParentRef)
+		if err != nil {
+			return err
+		}
+		if msg := checkCategoryParent(b.categories, cat.ID, parentID); msg != "" {
+			return batchFail(http.StatusBadRequest, "%s", msg)
+		}
+		cat.ParentID = parentID
+		if op.Order != nil {
+			cat.Order = *op.Order
+		}
+		cat.Rev++
+		b.audits = append(b.audits, batchAudit{"category.move", categoryTarget(cat.ID), b.categories[i], cat})
+		b.events = append(b.events, batchEvent{"category.updated", cat})
+		b.categories[i] = cat
+		res.ETag, res.Record = categoryETag(cat), cat
+	case "delete":
+		children, ok := parseDeleteChildren(op.Children)
+		if !ok {
+			return batchFail(http.StatusBadRequest, "invalid children mode")
+		}
+		removed := b.categories[i]
+		del, ok := planCategoryDeletion(b.categories, b.items, removed, children, b.user, b.now)
+		if !ok {
+			return batchFail(http.StatusConflict, "category has subcategories")
+		}
+		b.categories, b.items = del.categories, del.items
+		b.trash = append(b.trash, del.entries...)
+		b.audits = append(b.audits, batchAudit{"category.delete", categoryTarget(removed.ID), removed, map[string][]uint32{
+			"detached_items":        del.detachedIDs,
+			"deleted_subcategories": del.subtree,
+			"reparented_children":   del.reparentedIDs,
+		}})
+		for _, cat := range del.trashed {
+			b.events = append(b.events, batchEvent{"category.deleted", map[string]uint32{"id": cat.ID}})
+		}
+		for _, cat := range del.reparented {
+			b.events = append(b.events, batchEvent{"category.updated", cat})
+		}
+		for _, item := range del.detached {
+			b.events = append(b.events, batchEvent{"item.updated", item})
+		}
+	default:
+		return batchFail(http.StatusBadRequest, "invalid op")
+	}
+	return nil
+}
+
+// handleBatch applies a list of operations all-or-nothing: they run in
+// order against a working copy, and only if every one succeeds is the
+// result saved, in a single store update. The first failing operation is
+// reported with its index and nothing is changed.
+func (s *AppState) handleBatch(w http.ResponseWriter, r *http.Request) {
+	body, err := readBody(r, 5*1024*1024)
+	if err != nil {
+		writeText(w, http.StatusBadRequest, "invalid body")
+		return
+	}
+	var req struct {
+		Operations []batchOp `json:"operations"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeText(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > maxBatchOps {
+		writeText(w, http.StatusBadRequest, fmt.Sprintf("between 1 and %d operations required", maxBatchOps))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := &batchState{
+		nextID:     s.nextID,
+		categories: append([]Category{}, s.categories...),
+		items:      append([]Item{}, s.items...),
+		trash:      append([]TrashEntry{}, s.trash...),
+		refs:       map[string]uint32{},
+		user:       sessionUser(r),
+		now:        time.Now().UTC(),
+	}
+	results := make([]batchResult, 0, len(req.Operations))
+	for i, op := range req.Operations {
+		res, err := b.apply(op)
+		if err != nil {
+			status := http.StatusBadRequest
+			if be, ok := err.(*batchError); ok {
+				status = be.status
+			}
+			writeJSON(w, status, map[string]any{"index": i, "error": err.Error()})
+			return
+		}
+		res.Index = i
+		results = append(results, res)
+	}
+
+	before := s.dataLocked()
+	after := before
+	after.NextID, after.Categories, after.Items, after.Trash = b.nextID, b.categories, b.items, b.trash
+	diff := diffData(before, after)
+	trashed := b.trash[len(s.trash):]
+	err = s.commitBulk(func(tx StoreTx) error {
+		for _, cat := range diff.Categories.Removed {
+			if err := tx.DeleteCategory(cat.ID); err != nil {
+				return err
+			}
+		}
+		for _, item := range diff.Items.Removed {
+			if err := tx.DeleteItem(item.ID); err != nil {
+				return err
+			}
+		}
+		for _, cat := range append(diff.Categories.Added, changedRecords(diff.Categories.Changed)...) {
+			if err := tx.PutCategory(cat); err != nil {
+				return err
+			}
+		}
+		for _, item := range append(diff.Items.Added, changedRecords(diff.Items.Changed)...) {
+			if err := tx.PutItem(item); err != nil {
+				return err
+			}
+		}
+		for _, entry := range trashed {
+			if err := tx.PutTrash(entry); err != nil {
+				return err
+			}
+		}
+		return tx.SetNextID(b.nextID)
+	}, func() {
+		s.nextID = b.nextID
+		s.categories = b.categories
+		s.items = b.items
+		s.trash = b.trash
+		for _, a := range b.audits {
+			s.audit(r, a.action, a.target, a.before, a.after)
+		}
+		for _, e := range b.events {
+			s.events.publish(e.typ, e.data)
+		}
+	})
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"results": results})
+}
+
+func changedRecords[T any](changes []Change[T]) []T {
+	out := make([]T, 0, len(changes))
+	for _, c := range changes {
+		out = append(out, c.After)
+	}
+	return out
+}
@@ -0,0 +1,211 @@
+package nav
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// writeBookmarksHTML writes the Netscape bookmark format that every browser
+// can import: categories become folders, uncategorized items follow at the
+// top level.
+func writeBookmarksHTML(w io.Writer, cats []Category, items []Item) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("<!DOCTYPE NETSCAPE-Bookmark-file-1>\n")
+	bw.WriteString("<!-- This is an automatically generated file.\n     It will be read and overwritten.\n     DO NOT EDIT! -->\n")
+	bw.WriteString(`<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">` + "\n")
+	bw.WriteString("<TITLE>Bookmarks</TITLE>\n<H1>Bookmarks</H1>\n<DL><p>\n")
+
+	byCategory := map[uint32][]Item{}
+	known := map[uint32]bool{}
+	for _, cat := range cats {
+		known[cat.ID] = true
+	}
+	var loose []Item
+	for _, item := range items {
+		if item.CategoryID != nil && known[*item.CategoryID] {
+			byCategory[*item.CategoryID] = append(byCategory[*item.CategoryID], item)
+			continue
+		}
+		loose = append(loose, item)
+	}
+
+	for _, cat := range cats {
+		fmt.Fprintf(bw, "    <DT><H3>%s</H3>\n    <DL><p>\n", html.EscapeString(cat.Name))
+		for _, item := range byCategory[cat.ID] {
+			writeBookmark(bw, "        ", item)
+		}
+		bw.WriteString("    </DL><p>\n")
+	}
+	for _, item := range loose {
+		writeBookmark(bw, "    ", item)
+	}
+	bw.WriteString("</DL><p>\n")
+	return bw.Flush()
+}
+
+func writeBookmark(bw *bufio.Writer, indent string, item Item) {
+	fmt.Fprintf(bw, `%s<DT><A HREF="%s"`, indent, html.EscapeString(item.URL))
+	if icon := strings.TrimSpace(item.AvatarURL); icon != "" {
+		if strings.HasPrefix(icon, "data:") {
+			fmt.Fprintf(bw, ` ICON="%s"`, html.EscapeString(icon))
+		} else {
+			fmt.Fprintf(bw, ` ICON_URI="%s"`, html.EscapeString(icon))
+		}
+	}
+	if len(item.Tags) > 0 {
+		fmt.Fprintf(bw, ` TAGS="%s"`, html.EscapeString(strings.Join(item.Tags, ",")))
+	}
+	fmt.Fprintf(bw, ">%s</A>\n", html.EscapeString(item.Name))
+	if summary := strings.TrimSpace(item.Summary); summary != "" {
+		fmt.Fprintf(bw, "%s<DD>%s\n", indent, html.EscapeString(summary))
+	}
+}
+
+// parseBookmarksHTML reads a Netscape bookmark file. Links are filed under
+// the innermost folder they appear in; links outside any folder are left
+// uncategorized. Links other than http(s) (javascript:, place:, file:, ...)
+// are reported as row errors, rows counting links in file order.
+func parseBookmarksHTML(body []byte) (importSet, error) {
+	var set importSet
+	if !bytes.Contains(bytes.ToUpper(body[:min(len(body), 4096)]), []byte("NETSCAPE-BOOKMARK-FILE")) &&
+		!bytes.Contains(bytes.ToUpper(body), []byte("<DL")) {
+		return set, errors.New("not a bookmarks file")
+	}
+
+	z := xhtml.NewTokenizer(bytes.NewReader(body))
+	var (
+		folders     []string // one entry per open <DL>
+		pendingName *string  // folder name from the last <H3>, waiting for its <DL>
+		current     *importItem
+		text        strings.Builder
+		capture     atom.Atom // element whose text is being collected
+		row         int       // links seen so far
+	)
+	currentFolder := func() string {
+		for i := len(folders) - 1; i >= 0; i-- {
+			if folders[i] != "" {
+				return folders[i]
+			}
+		}
+		return ""
+	}
+	finishCapture := func() {
+		value := strings.TrimSpace(text.String())
+		switch capture {
+		case atom.H3:
+			pendingName = &value
+		case atom.A:
+			if current != nil {
+				current.item.Name = value
+			}
+		case atom.Dd:
+			if current != nil && value != "" {
+				current.item.Summary = value
+			}
+		}
+		capture = 0
+		text.Reset()
+	}
+	flushItem := func() {
+		if current != nil {
+			if current.item.Name == "" {
+				current.item.Name = current.item.URL
+			}
+			set.items = append(set.items, *current)
+			current = nil
+		}
+	}
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case xhtml.ErrorToken:
+			if errors.Is(z.Err(), io.EOF) {
+				if capture != 0 {
+					finishCapture()
+				}
+				flushItem()
+				return set, nil
+			}
+			return set, z.Err()
+		case xhtml.TextToken:
+			if capture != 0 {
+				text.Write(z.Text())
+			}
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			tok := z.Token()
+			switch tok.DataAtom {
+			case atom.Dt, atom.Dl, atom.H3, atom.A:
+				if capture == atom.Dd {
+					finishCapture()
+				}
+			}
+			switch tok.DataAtom {
+			case atom.Dl:
+				name := ""
+				if pendingName != nil {
+					name = *pendingName
+					pendingName = nil
+					if name != "" {
+						set.addCategory(name)
+					}
+				}
+				flushItem()
+				folders = append(folders, name)
+			case atom.H3:
+				flushItem()
+				capture = atom.H3
+			case atom.A:
+				flushItem()
+				row++
+				href := strings.TrimSpace(tokenAttr(tok, "href"))
+				if !validImportURL(href) {
+					set.addError(row, "url", "url must be an absolute http or https url")
+					continue
+				}
+				icon := tokenAttr(tok, "icon_uri")
+				if icon == "" {
+					icon = tokenAttr(tok, "icon")
+				}
+				tags, _ := normalizeTags(strings.Split(tokenAttr(tok, "tags"), ","))
+				current = &importItem{category: currentFolder(), item: Item{URL: href, AvatarURL: icon, Tags: tags}}
+				capture = atom.A
+			case atom.Dd:
+				capture = atom.Dd
+			}
+		case xhtml.EndTagToken:
+			tok := z.Token()
+			switch tok.DataAtom {
+			case atom.H3, atom.A:
+				if capture == tok.DataAtom {
+					finishCapture()
+				}
+			case atom.Dl:
+				if capture == atom.Dd {
+					finishCapture()
+				}
+				flushItem()
+				if len(folders) > 0 {
+					folders = folders[:len(folders)-1]
+				}
+			}
+		}
+	}
+}
+
+func tokenAttr(tok xhtml.Token, key string) string {
+	for _, a := range tok.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val
+		}
+	}
+	return ""
+}
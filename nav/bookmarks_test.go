@@ -0,0 +1,26 @@
+package nav
+
+import "testing"
+
+func TestParseBookmarksHTMLSkipsNonHTTPLinks(t *testing.T) {
+	body := []byte(`<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<DL><p>
+    <DT><A HREF="https://go.dev/">Go</A>
+    <DT><A HREF="place:sort=8&maxResults=10">Recent</A>
+    <DT><A HREF="file:///etc/passwd">passwd</A>
+    <DT><A HREF="data:text/html,hi">data</A>
+    <DT><A HREF="javascript:alert(1)">js</A>
+    <DT><A HREF="http://example.com/">Example</A>
+</DL><p>
+`)
+	set, err := parseBookmarksHTML(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.items) != 2 || set.items[0].item.URL != "https://go.dev/" || set.items[1].item.URL != "http://example.com/" {
+		t.Fatalf("got items %+v", set.items)
+	}
+	if len(set.errors) != 4 || set.errors[0].Row != 2 || set.errors[3].Row != 5 {
+		t.Fatalf("got errors %+v", set.errors)
+	}
+}
@@ -0,0 +1,230 @@
+package nav
+
+import "time"
+
+// categoryNode is a category with its subcategories, as returned by
+// GET /api/data?shape=tree.
+type categoryNode struct {
+	Category
+	Children []categoryNode `json:"children"`
+}
+
+const (
+	deleteChildrenReject   = "reject"
+	deleteChildrenReparent = "reparent"
+	deleteChildrenCascade  = "cascade"
+)
+
+func parseDeleteChildren(v string) (string, bool) {
+	switch v {
+	case "":
+		return deleteChildrenReject, true
+	case deleteChildrenReject, deleteChildrenReparent, deleteChildrenCascade:
+		return v, true
+	default:
+		return "", false
+	}
+}
+
+// childCategories returns the IDs of the direct children of id.
+func childCategories(cats []Category, id uint32) []uint32 {
+	var out []uint32
+	for _, cat := range cats {
+		if cat.ParentID != nil && *cat.ParentID == id {
+			out = append(out, cat.ID)
+		}
+	}
+	return out
+}
+
+// descendantCategories returns the IDs of every category below id.
+func descendantCategories(cats []Category, id uint32) []uint32 {
+	var out []uint32
+	seen := map[uint32]bool{id: true}
+	queue := []uint32{id}
+	for len(queue) > 0 {
+		next := childCategories(cats, queue[0])
+		queue = queue[1:]
+		for _, child := range next {
+			if !seen[child] {
+				seen[child] = true
+				out = append(out, child)
+				queue = append(queue, child)
+			}
+		}
+	}
+	return out
+}
+
+// createsCycle reports whether putting category id under parent would make
+// it its own ancestor.
+func createsCycle(cats []Category, id, parent uint32) bool {
+	parents := make(map[uint32]*uint32, len(cats))
+	for _, cat := range cats {
+		parents[cat.ID] = cat.ParentID
+	}
+	seen := map[uint32]bool{}
+	for cur := parent; !seen[cur]; {
+		if cur == id {
+			return true
+		}
+		seen[cur] = true
+		p := parents[cur]
+		if p == nil {
+			return false
+		}
+		cur = *p
+	}
+	return true
+}
+
+// categoryCycles returns the IDs of categories that are their own ancestor.
+func categoryCycles(cats []Category) []uint32 {
+	var out []uint32
+	for _, cat := range cats {
+		if cat.ParentID != nil && createsCycle(cats, cat.ID, *cat.ParentID) {
+			out = append(out, cat.ID)
+		}
+	}
+	return out
+}
+
+// buildCategoryTree nests categories under their parents, ordered by Order
+// then ID. Categories whose parent is missing, or that sit on a cycle in a
+// hand-edited file, are shown at the top level.
+func buildCategoryTree(cats []Category) []categoryNode {
+	sorted := sortedCategories(cats)
+	exists := make(map[uint32]bool, len(sorted))
+	for _, cat := range sorted {
+		exists[cat.ID] = true
+	}
+	children := map[uint32][]Category{}
+	var roots []Category
+	for _, cat := range sorted {
+		if cat.ParentID != nil && exists[*cat.ParentID] && *cat.ParentID != cat.ID {
+			children[*cat.ParentID] = append(children[*cat.ParentID], cat)
+		} else {
+			roots = append(roots, cat)
+		}
+	}
+
+	placed := map[uint32]bool{}
+	var build func(cat Category) categoryNode
+	build = func(cat Category) categoryNode {
+		placed[cat.ID] = true
+		node := categoryNode{Category: cat, Children: []categoryNode{}}
+		for _, child := range children[cat.ID] {
+			if !placed[child.ID] {
+				node.Children = append(node.Children, build(child))
+			}
+		}
+		return node
+	}
+	out := []categoryNode{}
+	for _, cat := range roots {
+		out = append(out, build(cat))
+	}
+	for _, cat := range sorted {
+		if !placed[cat.ID] {
+			out = append(out, build(cat))
+		}
+	}
+	return out
+}
+
+// checkCategoryParent validates the parent of a category that is created
+// (id 0) or updated.
+func checkCategoryParent(cats []Category, id uint32, parent *uint32) string {
+	if parent == nil {
+		return ""
+	}
+	exists := false
+	for _, cat := range cats {
+		if cat.ID == *parent {
+			exists = true
+			break
+		}
+	}
+	if !exists {
+		return "unknown parent"
+	}
+	if id != 0 && createsCycle(cats, id, *parent) {
+		return "parent would create a cycle"
+	}
+	return ""
+}
+
+func (s *AppState) checkParentLocked(id uint32, parent *uint32) string {
+	return checkCategoryParent(s.categories, id, parent)
+}
+
+// categoryDeletion is the outcome of deleting a category: the remaining
+// categories and items, and what moved to the trash or was detached.
+type categoryDeletion struct {
+	categories    []Category
+	items         []Item
+	trashed       []Category
+	reparented    []Category
+	detached      []Item
+	entries       []TrashEntry
+	subtree       []uint32
+	reparentedIDs []uint32
+	detachedIDs   []uint32
+}
+
+// planCategoryDeletion works out the deletion of removed with the given
+// children mode. It reports false when the mode rejects a category that
+// has subcategories.
+func planCategoryDeletion(cats []Category, items []Item, removed Category, children, user string, now time.Time) (categoryDeletion, bool) {
+	id := removed.ID
+	var del categoryDeletion
+	switch {
+	case children == deleteChildrenReject && len(childCategories(cats, id)) > 0:
+		return del, false
+	case children == deleteChildrenCascade:
+		del.subtree = descendantCategories(cats, id)
+	}
+	deleted := map[uint32]bool{id: true}
+	for _, sub := range del.subtree {
+		deleted[sub] = true
+	}
+
+	del.categories = make([]Category, 0, len(cats))
+	for _, cat := range cats {
+		switch {
+		case deleted[cat.ID]:
+			del.trashed = append(del.trashed, cat)
+			continue
+		case cat.ParentID != nil && *cat.ParentID == id:
+			cat.ParentID = removed.ParentID
+			cat.Rev++
+			del.reparented = append(del.reparented, cat)
+			del.reparentedIDs = append(del.reparentedIDs, cat.ID)
+		}
+		del.categories = append(del.categories, cat)
+	}
+
+	del.items = append([]Item{}, items...)
+	del.detachedIDs = []uint32{}
+	detachedFrom := map[uint32][]uint32{}
+	for i := range del.items {
+		if del.items[i].CategoryID != nil && deleted[*del.items[i].CategoryID] {
+			catID := *del.items[i].CategoryID
+			del.items[i].CategoryID = nil
+			del.items[i].Rev++
+			del.detached = append(del.detached, del.items[i])
+			del.detachedIDs = append(del.detachedIDs, del.items[i].ID)
+			detachedFrom[catID] = append(detachedFrom[catID], del.items[i].ID)
+		}
+	}
+
+	for _, cat := range del.trashed {
+		entry := TrashEntry{ID: cat.ID, Kind: trashKindCategory, DeletedAt: now, DeletedBy: user, Category: &cat, DetachedItems: detachedFrom[cat.ID]}
+		if cat.ID == id {
+			entry.Subtree = del.subtree
+			entry.ReparentedChildren = del.reparentedIDs
+		}
+		del.entries = append(del.entries, entry)
+	}
+	return del, true
+}
@@ -0,0 +1,157 @@
+package nav
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var csvColumns = []string{"name", "url", "category", "order", "summary", "avatar_url", "tags"}
+
+// writeCSV writes one row per item. The UTF-8 byte order mark makes
+// spreadsheet programs detect the encoding of non-ASCII names.
+func writeCSV(w io.Writer, cats []Category, items []Item) error {
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return err
+	}
+	names := categoryNames(cats)
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvColumns); err != nil {
+		return err
+	}
+	for _, cat := range append(cats, Category{}) {
+		for _, item := range items {
+			if !itemInCategory(item, cat.ID, names) {
+				continue
+			}
+			row := []string{item.Name, item.URL, cat.Name, strconv.Itoa(int(item.Order)), item.Summary, item.AvatarURL, strings.Join(item.Tags, ",")}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// itemInCategory reports whether item belongs under the category with the
+// given ID; ID 0 collects items without a (known) category.
+func itemInCategory(item Item, catID uint32, names map[uint32]string) bool {
+	if item.CategoryID == nil {
+		return catID == 0
+	}
+	if _, ok := names[*item.CategoryID]; !ok {
+		return catID == 0
+	}
+	return *item.CategoryID == catID
+}
+
+// parseCSV reads rows of name, url, category, order, summary, avatar_url
+// and comma-separated tags.
+// A header row may reorder or omit columns; without one the default order
+// is assumed. Invalid rows are reported and skipped.
+func parseCSV(body []byte) (importSet, error) {
+	var set importSet
+	body = bytes.TrimPrefix(body, []byte("\ufeff"))
+	cr := csv.NewReader(bytes.NewReader(body))
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	columns := map[string]int{}
+	for i, name := range csvColumns {
+		columns[name] = i
+	}
+	row := 0
+	first := true
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		row++
+		if err != nil {
+			var perr *csv.ParseError
+			if errors.As(err, &perr) {
+				set.addError(row, "", perr.Err.Error())
+				continue
+			}
+			return set, err
+		}
+		if first {
+			first = false
+			if header, ok := csvHeader(record); ok {
+				columns = header
+				row--
+				continue
+			}
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			row--
+			continue
+		}
+
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		in := importItem{
+			category: field("category"),
+			item: Item{
+				Name:      field("name"),
+				URL:       field("url"),
+				Summary:   field("summary"),
+				AvatarURL: field("avatar_url"),
+			},
+		}
+		if in.item.Name == "" {
+			set.addError(row, "name", "name required")
+			continue
+		}
+		if !validImportURL(in.item.URL) {
+			set.addError(row, "url", "url must be an absolute http or https url")
+			continue
+		}
+		tags, err := normalizeTags(strings.Split(field("tags"), ","))
+		if err != nil {
+			set.addError(row, "tags", err.Error())
+			continue
+		}
+		in.item.Tags = tags
+		if v := field("order"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 32)
+			if err != nil {
+				set.addError(row, "order", "order must be an integer")
+				continue
+			}
+			order := int32(n)
+			in.order = &order
+		}
+		if in.category != "" {
+			set.addCategory(in.category)
+		}
+		set.items = append(set.items, in)
+	}
+	return set, nil
+}
+
+// csvHeader recognises a header row by its column names.
+func csvHeader(record []string) (map[string]int, bool) {
+	columns := map[string]int{}
+	for i, cell := range record {
+		name := strings.ToLower(strings.TrimSpace(cell))
+		for _, known := range csvColumns {
+			if name == known {
+				columns[name] = i
+			}
+		}
+	}
+	_, hasName := columns["name"]
+	_, hasURL := columns["url"]
+	return columns, hasName && hasURL
+}
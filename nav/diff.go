@@ -0,0 +1,78 @@
+package nav
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// DataDiff describes what changes when going from one DataFile to another.
+type DataDiff struct {
+	Categories   RecordDiff[Category] `json:"categories"`
+	Items        RecordDiff[Item]     `json:"items"`
+	NextIDBefore uint32               `json:"next_id_before"`
+	NextIDAfter  uint32               `json:"next_id_after"`
+	AdminChanged bool                 `json:"admin_changed"`
+}
+
+type RecordDiff[T any] struct {
+	Added   []T         `json:"added"`
+	Removed []T         `json:"removed"`
+	Changed []Change[T] `json:"changed"`
+}
+
+type Change[T any] struct {
+	ID     uint32 `json:"id"`
+	Before T      `json:"before"`
+	After  T      `json:"after"`
+}
+
+func (d DataDiff) Empty() bool {
+	return d.Categories.empty() && d.Items.empty() && d.NextIDBefore == d.NextIDAfter && !d.AdminChanged
+}
+
+func (d RecordDiff[T]) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+func diffData(before, after DataFile) DataDiff {
+	return DataDiff{
+		Categories:   diffRecords(before.Categories, after.Categories, func(c Category) uint32 { return c.ID }),
+		Items:        diffRecords(before.Items, after.Items, func(it Item) uint32 { return it.ID }),
+		NextIDBefore: before.NextID,
+		NextIDAfter:  after.NextID,
+		AdminChanged: before.Admin != after.Admin,
+	}
+}
+
+func diffRecords[T any](before, after []T, id func(T) uint32) RecordDiff[T] {
+	out := RecordDiff[T]{Added: []T{}, Removed: []T{}, Changed: []Change[T]{}}
+	old := make(map[uint32]T, len(before))
+	for _, v := range before {
+		old[id(v)] = v
+	}
+	seen := make(map[uint32]bool, len(after))
+	for _, v := range after {
+		key := id(v)
+		seen[key] = true
+		prev, ok := old[key]
+		if !ok {
+			out.Added = append(out.Added, v)
+			continue
+		}
+		if !sameJSON(prev, v) {
+			out.Changed = append(out.Changed, Change[T]{ID: key, Before: prev, After: v})
+		}
+	}
+	for _, v := range before {
+		if !seen[id(v)] {
+			out.Removed = append(out.Removed, v)
+		}
+	}
+	return out
+}
+
+func sameJSON(a, b any) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
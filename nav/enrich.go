@@ -0,0 +1,177 @@
+package nav
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"wrzapi/internal/httpclient"
+	"wrzapi/internal/pageinfo"
+)
+
+const (
+	enrichTimeout     = 15 * time.Second
+	enrichConcurrency = 4
+)
+
+// enricher fetches item pages in the background to fill in metadata.
+// At most one fetch per item is in flight.
+type enricher struct {
+	fetch   func(ctx context.Context, rawURL string) (pageinfo.Result, error)
+	sem     chan struct{}
+	mu      sync.Mutex
+	pending map[uint32]bool
+}
+
+func newEnricher() *enricher {
+	client := httpclient.New()
+	return &enricher{
+		fetch: func(ctx context.Context, rawURL string) (pageinfo.Result, error) {
+			body, finalURL, err := client.FetchHTML(ctx, rawURL)
+			if err != nil {
+				return pageinfo.Result{}, err
+			}
+			return pageinfo.ParseHTML(body, finalURL), nil
+		},
+		sem:     make(chan struct{}, enrichConcurrency),
+		pending: map[uint32]bool{},
+	}
+}
+
+// enrichJob names the fields to fill: a field is only overwritten if it
+// still holds the value it had when the job was queued, so edits made in
+// the meantime win.
+type enrichJob struct {
+	id      uint32
+	url     string
+	name    *string
+	summary *string
+	avatar  *string
+	user    string
+	ip      string
+}
+
+// newEnrichJob queues the empty fields of item, plus the name when it is
+// only a placeholder.
+func (s *AppState) newEnrichJob(r *http.Request, item Item, placeholderName bool) enrichJob {
+	job := enrichJob{id: item.ID, url: item.URL, user: sessionUser(r), ip: s.clientIP(r)}
+	if placeholderName || strings.TrimSpace(item.Name) == "" {
+		job.name = &item.Name
+	}
+	if strings.TrimSpace(item.Summary) == "" {
+		job.summary = &item.Summary
+	}
+	if strings.TrimSpace(item.AvatarURL) == "" {
+		job.avatar = &item.AvatarURL
+	}
+	return job
+}
+
+func (j enrichJob) empty() bool {
+	return j.name == nil && j.summary == nil && j.avatar == nil
+}
+
+// enqueueEnrich starts a background fetch for job. It reports false if one is
+// already running for the item.
+func (s *AppState) enqueueEnrich(job enrichJob) bool {
+	e := s.enricher
+	e.mu.Lock()
+	if e.pending[job.id] {
+		e.mu.Unlock()
+		return false
+	}
+	e.pending[job.id] = true
+	e.mu.Unlock()
+
+	go func() {
+		defer func() {
+			e.mu.Lock()
+			delete(e.pending, job.id)
+			e.mu.Unlock()
+		}()
+		e.sem <- struct{}{}
+		defer func() { <-e.sem }()
+		ctx, cancel := context.WithTimeout(context.Background(), enrichTimeout)
+		defer cancel()
+		res, err := e.fetch(ctx, job.url)
+		if err != nil {
+			log.Printf("nav: enrich item %d from %s failed: %v", job.id, job.url, err)
+			return
+		}
+		s.applyEnrich(job, res)
+	}()
+	return true
+}
+
+func (s *AppState) applyEnrich(job enrichJob, res pageinfo.Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.items {
+		item := s.items[i]
+		if item.ID != job.id {
+			continue
+		}
+		if item.URL != job.url {
+			return
+		}
+		next := item
+		changed := false
+		fill := func(field *string, expect *string, value string) {
+			value = strings.TrimSpace(value)
+			if expect != nil && *field == *expect && value != "" && value != *field {
+				*field = value
+				changed = true
+			}
+		}
+		fill(&next.Name, job.name, res.Title)
+		fill(&next.Summary, job.summary, res.Description)
+		fill(&next.AvatarURL, job.avatar, res.Icon)
+		if !changed {
+			return
+		}
+		next.Rev++
+		err := s.commit(func(tx StoreTx) error {
+			return tx.PutItem(next)
+		}, func() {
+			s.auditAs(job.user, job.ip, "item.enrich", itemTarget(item.ID), item, next)
+			s.items[i] = next
+			s.events.publish("item.updated", next)
+		})
+		if err != nil {
+			log.Printf("nav: enrich item %d: save failed: %v", job.id, err)
+		}
+		return
+	}
+}
+
+// handleRefreshItem queues a metadata fetch for an item and returns at
+// once; the update arrives as an item.updated event.
+func (s *AppState) handleRefreshItem(w http.ResponseWriter, r *http.Request, id uint32) {
+	s.mu.Lock()
+	var job enrichJob
+	found := false
+	for _, item := range s.items {
+		if item.ID == id {
+			job = s.newEnrichJob(r, item, false)
+			found = true
+			break
+		}
+	}
+	s.mu.Unlock()
+	if !found {
+		writeText(w, http.StatusNotFound, "not found")
+		return
+	}
+	if job.empty() {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "complete"})
+		return
+	}
+	if !s.enqueueEnrich(job) {
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "pending"})
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "queued"})
+}
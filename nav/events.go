@@ -0,0 +1,198 @@
+package nav
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	eventBacklog      = 512
+	eventSubBuffer    = 64
+	eventHeartbeat    = 20 * time.Second
+	eventRetryMillis  = 3000
+	eventTypeResync   = "resync"
+	eventTypeRestored = "data.restored"
+)
+
+type event struct {
+	id   string
+	typ  string
+	data any
+	seq  uint64
+}
+
+// eventHub fans out change events to SSE subscribers and keeps a short
+// backlog so reconnecting clients can resume from Last-event-ID. event IDs
+// carry the process start time, so IDs from before a restart are detected
+// and answered with a resync event.
+type eventHub struct {
+	mu      sync.Mutex
+	epoch   int64
+	seq     uint64
+	backlog []event
+	subs    map[chan event]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{epoch: time.Now().UnixNano(), subs: map[chan event]struct{}{}}
+}
+
+func (h *eventHub) publish(typ string, data any) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	ev := event{id: fmt.Sprintf("%d-%d", h.epoch, h.seq), typ: typ, data: data, seq: h.seq}
+	h.backlog = append(h.backlog, ev)
+	if len(h.backlog) > eventBacklog {
+		h.backlog = h.backlog[len(h.backlog)-eventBacklog:]
+	}
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+			// A subscriber that cannot keep up is dropped; it will
+			// reconnect and resume from its last event ID.
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe registers a subscriber and returns the events it missed since
+// lastID. resync is true when those events are no longer available.
+func (h *eventHub) subscribe(lastID string) (ch chan event, missed []event, resync bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch = make(chan event, eventSubBuffer)
+	h.subs[ch] = struct{}{}
+	if lastID == "" {
+		return ch, nil, false
+	}
+	epoch, seq, ok := parseEventID(lastID)
+	if !ok || epoch != h.epoch || seq > h.seq {
+		return ch, nil, true
+	}
+	if seq == h.seq {
+		return ch, nil, false
+	}
+	if len(h.backlog) == 0 || h.backlog[0].seq > seq+1 {
+		return ch, nil, true
+	}
+	for _, ev := range h.backlog {
+		if ev.seq > seq {
+			missed = append(missed, ev)
+		}
+	}
+	return ch, missed, false
+}
+
+func (h *eventHub) unsubscribe(ch chan event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[ch]; ok {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+func parseEventID(id string) (int64, uint64, bool) {
+	epochStr, seqStr, ok := strings.Cut(id, "-")
+	if !ok {
+		return 0, 0, false
+	}
+	epoch, err := strconv.ParseInt(epochStr, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return epoch, seq, true
+}
+
+func writeEvent(w http.ResponseWriter, ev event) error {
+	payload, err := json.Marshal(ev.data)
+	if err != nil {
+		return err
+	}
+	if ev.id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", ev.id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.typ, payload)
+	return err
+}
+
+func (s *AppState) handleEvents(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	lastID := r.Header.Get("Last-event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+
+	_, admin := s.sessionUserFor(r)
+	send := func(ev event) error {
+		if !admin {
+			var ok bool
+			if ev, ok = s.anonymousEvent(ev); !ok {
+				return nil
+			}
+		}
+		return writeEvent(w, ev)
+	}
+
+	ch, missed, resync := s.events.subscribe(lastID)
+	defer s.events.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", eventRetryMillis); err != nil {
+		return
+	}
+	if resync {
+		if err := writeEvent(w, event{typ: eventTypeResync, data: map[string]string{}}); err != nil {
+			return
+		}
+	}
+	for _, ev := range missed {
+		if err := send(ev); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := send(ev); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
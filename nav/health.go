@@ -0,0 +1,374 @@
+package nav
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"wrzapi/internal/httpclient"
+)
+
+const (
+	linkCheckWorkers   = 4
+	linkCheckQueueSize = 1024
+	linkCheckTimeout   = 30 * time.Second
+	linkCheckInterval  = 24 * time.Hour
+	linkRetryInterval  = 6 * time.Hour
+	linkCheckTick      = time.Hour
+	linkSaveInterval   = time.Minute
+)
+
+// Link states reported by GET /api/health/items, in the order they are
+// listed.
+const (
+	linkBroken    = "broken"
+	linkMoved     = "moved"
+	linkUnchecked = "unchecked"
+	linkOK        = "ok"
+)
+
+var linkStateOrder = map[string]int{linkBroken: 0, linkMoved: 1, linkUnchecked: 2, linkOK: 3}
+
+// linkHealth is the last check of an item's URL. A result only applies
+// while the item still has that URL.
+type linkHealth struct {
+	URL         string     `json:"url"`
+	Status      int        `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	LatencyMS   int64      `json:"latency_ms"`
+	RedirectURL string     `json:"redirect_url,omitempty"`
+	Permanent   bool       `json:"permanent,omitempty"`
+	CheckedAt   time.Time  `json:"checked_at"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	Failures    int        `json:"failures,omitempty"`
+}
+
+// reachable reports whether the site answered in a way that means the page
+// exists: a success or redirect, or a refusal to an anonymous client.
+func (h linkHealth) reachable() bool {
+	switch {
+	case h.Error != "" || h.Status == 0:
+		return false
+	case h.Status < 400:
+		return true
+	}
+	return h.Status == http.StatusUnauthorized || h.Status == http.StatusForbidden || h.Status == http.StatusTooManyRequests
+}
+
+func (h linkHealth) state() string {
+	switch {
+	case !h.reachable():
+		return linkBroken
+	case h.Permanent && h.RedirectURL != "":
+		return linkMoved
+	}
+	return linkOK
+}
+
+// linkChecker checks item URLs on a small worker pool and keeps the results
+// in one JSON file next to the nav data, which a single goroutine rewrites
+// at most every linkSaveInterval. Like the icon cache, items that do not
+// fit in the queue are picked up by the next periodic check.
+type linkChecker struct {
+	path    string
+	check   func(ctx context.Context, rawURL string) (httpclient.LinkStatus, error)
+	jobs    chan linkJob
+	mu      sync.Mutex
+	results map[uint32]linkHealth
+	pending map[uint32]bool
+	dirty   bool
+}
+
+type linkJob struct {
+	id  uint32
+	url string
+}
+
+func newLinkChecker(path string) *linkChecker {
+	c := &linkChecker{
+		path:    path,
+		check:   httpclient.New().CheckLink,
+		jobs:    make(chan linkJob, linkCheckQueueSize),
+		results: map[uint32]linkHealth{},
+		pending: map[uint32]bool{},
+	}
+	if raw, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(raw, &c.results); err != nil {
+			log.Printf("nav: ignoring link health file %s: %v", path, err)
+			c.results = map[uint32]linkHealth{}
+		}
+	}
+	for i := 0; i < linkCheckWorkers; i++ {
+		go c.work()
+	}
+	go c.runSaver()
+	return c
+}
+
+// linkCheckable reports whether an item's URL can be checked. URLs with
+// alias parameters are templates, not pages.
+func linkCheckable(item Item) bool {
+	return validImportURL(item.URL) && !urlTemplateParam.MatchString(item.URL)
+}
+
+// sync queues a check for items whose URL was never checked. It is cheap
+// enough to run after every commit.
+func (c *linkChecker) sync(items []Item) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, item := range items {
+		if !linkCheckable(item) {
+			continue
+		}
+		if h, ok := c.results[item.ID]; ok && h.URL == item.URL {
+			continue
+		}
+		c.queueLocked(linkJob{id: item.ID, url: item.URL})
+	}
+}
+
+// checkDue queues items whose last check is older than the check interval,
+// or the retry interval for broken links, and drops the results of items
+// that no longer exist.
+func (c *linkChecker) checkDue(items []Item) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	live := make(map[uint32]bool, len(items))
+	for _, item := range items {
+		if !linkCheckable(item) {
+			continue
+		}
+		live[item.ID] = true
+		h, ok := c.results[item.ID]
+		due := !ok || h.URL != item.URL
+		if !due {
+			interval := linkCheckInterval
+			if !h.reachable() {
+				interval = linkRetryInterval
+			}
+			due = now.Sub(h.CheckedAt) >= interval
+		}
+		if due {
+			c.queueLocked(linkJob{id: item.ID, url: item.URL})
+		}
+	}
+	for id := range c.results {
+		if !live[id] && !c.pending[id] {
+			delete(c.results, id)
+			c.dirty = true
+		}
+	}
+}
+
+func (c *linkChecker) queueLocked(job linkJob) {
+	if c.pending[job.id] {
+		return
+	}
+	select {
+	case c.jobs <- job:
+		c.pending[job.id] = true
+	default:
+	}
+}
+
+func (c *linkChecker) work() {
+	for job := range c.jobs {
+		c.run(job)
+		c.mu.Lock()
+		delete(c.pending, job.id)
+		c.mu.Unlock()
+	}
+}
+
+// run checks one URL and stores the result. The last success and the count
+// of consecutive failures carry over from earlier checks of the same URL.
+func (c *linkChecker) run(job linkJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), linkCheckTimeout)
+	defer cancel()
+	status, err := c.check(ctx, job.url)
+
+	now := time.Now().UTC()
+	next := linkHealth{
+		URL:       job.url,
+		Status:    status.StatusCode,
+		LatencyMS: status.Latency.Milliseconds(),
+		CheckedAt: now,
+	}
+	if err != nil {
+		next.Error = err.Error()
+	}
+	if status.FinalURL != "" && status.FinalURL != job.url {
+		next.RedirectURL = status.FinalURL
+		next.Permanent = status.Permanent
+	}
+
+	c.mu.Lock()
+	if prev, ok := c.results[job.id]; ok && prev.URL == job.url {
+		next.LastSuccess, next.Failures = prev.LastSuccess, prev.Failures
+	}
+	if next.reachable() {
+		next.LastSuccess, next.Failures = &now, 0
+	} else {
+		next.Failures++
+	}
+	c.results[job.id] = next
+	c.dirty = true
+	c.mu.Unlock()
+}
+
+// runSaver writes the results whenever they changed since the last write.
+// It is the only writer of the file.
+func (c *linkChecker) runSaver() {
+	ticker := time.NewTicker(linkSaveInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		c.save()
+	}
+}
+
+func (c *linkChecker) save() {
+	c.mu.Lock()
+	if !c.dirty {
+		c.mu.Unlock()
+		return
+	}
+	payload, err := json.Marshal(c.results)
+	c.dirty = false
+	c.mu.Unlock()
+	if err == nil {
+		err = writeFileAtomic(c.path, payload, 0644)
+	}
+	if err != nil {
+		log.Printf("nav: store link health failed: %v", err)
+		c.mu.Lock()
+		c.dirty = true
+		c.mu.Unlock()
+	}
+}
+
+// get returns the result of the last check of rawURL for an item.
+func (c *linkChecker) get(id uint32, rawURL string) (linkHealth, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h, ok := c.results[id]
+	if !ok || h.URL != rawURL {
+		return linkHealth{}, false
+	}
+	return h, true
+}
+
+func (s *AppState) checkLinks() {
+	s.mu.Lock()
+	items := append([]Item{}, s.items...)
+	s.mu.Unlock()
+	s.links.checkDue(items)
+}
+
+func (s *AppState) runLinkChecker() {
+	s.checkLinks()
+	ticker := time.NewTicker(linkCheckTick)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.checkLinks()
+	}
+}
+
+type itemHealth struct {
+	ID    uint32      `json:"id"`
+	Name  string      `json:"name"`
+	URL   string      `json:"url"`
+	State string      `json:"state"`
+	Check *linkHealth `json:"check"`
+}
+
+// handleItemHealth lists the link state of every checkable item: broken
+// links first, then moved (permanently redirected) ones, unchecked and ok.
+// state= keeps only the items in the given state.
+func (s *AppState) handleItemHealth(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("state")
+	if _, ok := linkStateOrder[filter]; filter != "" && !ok {
+		writeText(w, http.StatusBadRequest, "invalid state")
+		return
+	}
+
+	s.mu.Lock()
+	items := append([]Item{}, s.items...)
+	s.mu.Unlock()
+
+	counts := map[string]int{linkBroken: 0, linkMoved: 0, linkUnchecked: 0, linkOK: 0}
+	out := []itemHealth{}
+	for _, item := range items {
+		if !linkCheckable(item) {
+			continue
+		}
+		entry := itemHealth{ID: item.ID, Name: item.Name, URL: item.URL, State: linkUnchecked}
+		if h, ok := s.links.get(item.ID, item.URL); ok {
+			entry.State, entry.Check = h.state(), &h
+		}
+		counts[entry.State]++
+		if filter == "" || entry.State == filter {
+			out = append(out, entry)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].State != out[j].State {
+			return linkStateOrder[out[i].State] < linkStateOrder[out[j].State]
+		}
+		return out[i].ID < out[j].ID
+	})
+	writeJSON(w, http.StatusOK, map[string]any{
+		"counts": counts,
+		"items":  out,
+	})
+}
+
+// handleFollowRedirect replaces an item's URL with the one its site
+// permanently redirects to, as found by the last link check.
+func (s *AppState) handleFollowRedirect(w http.ResponseWriter, r *http.Request, id uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx := -1
+	for i := range s.items {
+		if s.items[i].ID == id {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		writeText(w, http.StatusNotFound, "not found")
+		return
+	}
+	before := s.items[idx]
+	if !ifMatch(r, itemETag(before)) {
+		writeText(w, http.StatusPreconditionFailed, "precondition failed")
+		return
+	}
+	h, ok := s.links.get(id, before.URL)
+	if !ok || h.state() != linkMoved || !validImportURL(h.RedirectURL) {
+		writeText(w, http.StatusConflict, "no permanent redirect recorded")
+		return
+	}
+
+	after := before
+	after.URL = h.RedirectURL
+	after.Rev++
+	err := s.commit(func(tx StoreTx) error {
+		return tx.PutItem(after)
+	}, func() {
+		s.audit(r, "item.follow_redirect", itemTarget(id), before, after)
+		s.items[idx] = after
+		s.events.publish("item.updated", after)
+	})
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	w.Header().Set("ETag", itemETag(after))
+	writeJSON(w, http.StatusOK, after)
+}
@@ -0,0 +1,46 @@
+package nav
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"wrzapi/internal/httpclient"
+)
+
+func TestLinkCheckerSavesOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json.health.json")
+	c := &linkChecker{
+		path: path,
+		check: func(ctx context.Context, rawURL string) (httpclient.LinkStatus, error) {
+			return httpclient.LinkStatus{StatusCode: 200, FinalURL: rawURL}, nil
+		},
+		results: map[uint32]linkHealth{},
+		pending: map[uint32]bool{},
+	}
+	c.run(linkJob{id: 1, url: "https://a.example/"})
+	c.run(linkJob{id: 2, url: "https://b.example/"})
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("results written before save: %v", err)
+	}
+
+	c.save()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved map[uint32]linkHealth
+	if err := json.Unmarshal(raw, &saved); err != nil || len(saved) != 2 || saved[1].state() != linkOK {
+		t.Fatalf("got %s, %v", raw, err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	c.save()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("unchanged results written again: %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package nav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// Favicons are mostly served as .ico files, which the standard library
+// cannot decode. This decoder handles the two encodings browsers use: an
+// embedded PNG, or a BMP-style DIB (1, 4, 8, 24 or 32 bits per pixel, with
+// the AND transparency mask).
+
+var errInvalidICO = errors.New("ico: invalid image")
+
+func init() {
+	image.RegisterFormat("ico", "\x00\x00\x01\x00", decodeICO, decodeICOConfig)
+}
+
+// icoEntry returns the data of the largest image in the icon.
+func icoEntry(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 6 || binary.LittleEndian.Uint16(data[2:4]) != 1 {
+		return nil, errInvalidICO
+	}
+	count := int(binary.LittleEndian.Uint16(data[4:6]))
+	best, bestSize, bestBits := -1, 0, 0
+	for i := 0; i < count; i++ {
+		off := 6 + 16*i
+		if off+16 > len(data) {
+			return nil, errInvalidICO
+		}
+		size := int(data[off])
+		if size == 0 {
+			size = 256
+		}
+		bits := int(binary.LittleEndian.Uint16(data[off+6 : off+8]))
+		if size > bestSize || (size == bestSize && bits > bestBits) {
+			best, bestSize, bestBits = i, size, bits
+		}
+	}
+	if best < 0 {
+		return nil, errInvalidICO
+	}
+	entry := data[6+16*best:]
+	length := int(binary.LittleEndian.Uint32(entry[8:12]))
+	start := int(binary.LittleEndian.Uint32(entry[12:16]))
+	if start < 0 || length <= 0 || start+length > len(data) || start+length < start {
+		return nil, errInvalidICO
+	}
+	return data[start : start+length], nil
+}
+
+func decodeICO(r io.Reader) (image.Image, error) {
+	data, err := icoEntry(r)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte("\x89PNG")) {
+		return png.Decode(bytes.NewReader(data))
+	}
+	return decodeDIB(data)
+}
+
+// decodeICOConfig reads the size of the image decodeICO would return from
+// the PNG or DIB header alone, so callers can refuse large images before
+// any pixels are decoded.
+func decodeICOConfig(r io.Reader) (image.Config, error) {
+	data, err := icoEntry(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	if bytes.HasPrefix(data, []byte("\x89PNG")) {
+		return png.DecodeConfig(bytes.NewReader(data))
+	}
+	_, width, height, _, err := dibHeader(data)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.NRGBAModel, Width: width, Height: height}, nil
+}
+
+// dibHeader validates a BITMAPINFOHEADER and returns its size, the image
+// dimensions (without the AND mask) and the bits per pixel.
+func dibHeader(data []byte) (headerSize, width, height, bpp int, err error) {
+	if len(data) < 40 {
+		return 0, 0, 0, 0, errInvalidICO
+	}
+	le := binary.LittleEndian
+	headerSize = int(le.Uint32(data[0:4]))
+	width = int(int32(le.Uint32(data[4:8])))
+	height = int(int32(le.Uint32(data[8:12]))) / 2
+	bpp = int(le.Uint16(data[14:16]))
+	if headerSize < 40 || headerSize > len(data) || le.Uint32(data[16:20]) != 0 ||
+		width <= 0 || width > 256 || height <= 0 || height > 256 {
+		return 0, 0, 0, 0, errInvalidICO
+	}
+	return headerSize, width, height, bpp, nil
+}
+
+// decodeDIB decodes an icon bitmap: a BITMAPINFOHEADER whose height counts
+// both the colour rows and the 1-bit AND mask that follows them, both
+// stored bottom-up.
+func decodeDIB(data []byte) (image.Image, error) {
+	headerSize, width, height, bpp, err := dibHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+
+	var palette []color.NRGBA
+	pos := headerSize
+	switch bpp {
+	case 1, 4, 8:
+		colors := int(le.Uint32(data[32:36]))
+		if colors == 0 || colors > 1<<bpp {
+			colors = 1 << bpp
+		}
+		if pos+4*colors > len(data) {
+			return nil, errInvalidICO
+		}
+		for i := 0; i < colors; i++ {
+			p := data[pos+4*i:]
+			palette = append(palette, color.NRGBA{R: p[2], G: p[1], B: p[0], A: 0xff})
+		}
+		pos += 4 * colors
+	case 24, 32:
+	default:
+		return nil, errInvalidICO
+	}
+
+	stride := (width*bpp + 31) / 32 * 4
+	maskStride := (width + 31) / 32 * 4
+	if pos+stride*height > len(data) {
+		return nil, errInvalidICO
+	}
+	pixels := data[pos : pos+stride*height]
+	var mask []byte
+	if end := pos + stride*height + maskStride*height; end <= len(data) {
+		mask = data[pos+stride*height : end]
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	hasAlpha := false
+	for y := 0; y < height; y++ {
+		row := pixels[(height-1-y)*stride:]
+		for x := 0; x < width; x++ {
+			var c color.NRGBA
+			switch bpp {
+			case 32:
+				c = color.NRGBA{R: row[4*x+2], G: row[4*x+1], B: row[4*x], A: row[4*x+3]}
+				hasAlpha = hasAlpha || c.A != 0
+			case 24:
+				c = color.NRGBA{R: row[3*x+2], G: row[3*x+1], B: row[3*x], A: 0xff}
+			default:
+				bit := x * bpp
+				idx := int(row[bit/8]>>(8-bpp-bit%8)) & (1<<bpp - 1)
+				if idx < len(palette) {
+					c = palette[idx]
+				}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	// 32-bit icons carry their own alpha; the mask only matters for the
+	// others (and for old 32-bit icons that leave alpha at zero).
+	if bpp == 32 && hasAlpha {
+		return img, nil
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := img.NRGBAAt(x, y)
+			c.A = 0xff
+			if mask != nil && mask[(height-1-y)*maskStride+x/8]>>(7-x%8)&1 == 1 {
+				c.A = 0
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img, nil
+}
@@ -0,0 +1,57 @@
+package nav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"testing"
+)
+
+// icoWith wraps one image entry in an ICO directory.
+func icoWith(entry []byte) []byte {
+	var b bytes.Buffer
+	le := binary.LittleEndian
+	_ = binary.Write(&b, le, []uint16{0, 1, 1})
+	b.Write([]byte{0, 0, 0, 0})
+	_ = binary.Write(&b, le, []uint16{1, 32})
+	_ = binary.Write(&b, le, []uint32{uint32(len(entry)), 22})
+	b.Write(entry)
+	return b.Bytes()
+}
+
+func TestICOConfigEmbeddedPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, iconMaxDecode+1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	ico := icoWith(buf.Bytes())
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(ico))
+	if err != nil || format != "ico" || cfg.Width != iconMaxDecode+1 || cfg.Height != 1 {
+		t.Fatalf("got %+v %q %v", cfg, format, err)
+	}
+	if _, err := normalizeIcon(ico, "image/x-icon"); err != errUnsupportedIcon {
+		t.Fatalf("oversized icon: got %v, want %v", err, errUnsupportedIcon)
+	}
+}
+
+func TestICOConfigDIB(t *testing.T) {
+	dib := make([]byte, 40+2*2*4+2*4)
+	le := binary.LittleEndian
+	le.PutUint32(dib[0:4], 40)
+	le.PutUint32(dib[4:8], 2)
+	le.PutUint32(dib[8:12], 4)
+	le.PutUint16(dib[12:14], 1)
+	le.PutUint16(dib[14:16], 32)
+	ico := icoWith(dib)
+
+	cfg, err := decodeICOConfig(bytes.NewReader(ico))
+	if err != nil || cfg.Width != 2 || cfg.Height != 2 {
+		t.Fatalf("got %+v %v", cfg, err)
+	}
+	img, err := decodeICO(bytes.NewReader(ico))
+	if err != nil || img.Bounds().Dx() != 2 || img.Bounds().Dy() != 2 {
+		t.Fatalf("decode: got %v %v", img, err)
+	}
+}
@@ -0,0 +1,374 @@
+package nav
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+
+	"wrzapi/internal/httpclient"
+)
+
+const (
+	iconMaxSize         = 128
+	iconMaxDecode       = 4096
+	iconFetchTimeout    = 15 * time.Second
+	iconWorkers         = 4
+	iconQueueSize       = 1024
+	iconRefreshInterval = 7 * 24 * time.Hour
+	iconRetryInterval   = 6 * time.Hour
+	iconCheckInterval   = time.Hour
+	iconCacheMaxAge     = 7 * 24 * time.Hour
+)
+
+var errUnsupportedIcon = errors.New("unsupported icon type")
+
+// iconCache keeps a PNG copy of every item's icon in dir as <id>.png, with
+// <id>.json recording where it came from and when. Fetches run on a small
+// worker pool; items that do not fit in the queue are picked up by the
+// next periodic check.
+type iconCache struct {
+	dir     string
+	fetch   func(ctx context.Context, rawURL string) ([]byte, string, error)
+	jobs    chan iconJob
+	mu      sync.Mutex
+	meta    map[uint32]iconMeta
+	pending map[uint32]bool
+}
+
+// iconMeta describes the cached icon of an item. ETag is empty while no
+// icon is stored, i.e. every fetch so far failed.
+type iconMeta struct {
+	Source    string    `json:"source"`
+	FetchedAt time.Time `json:"fetched_at"`
+	ETag      string    `json:"etag,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type iconJob struct {
+	id       uint32
+	source   string
+	fallback string
+}
+
+func newIconCache(dir string) *iconCache {
+	client := httpclient.New()
+	c := &iconCache{
+		dir:     dir,
+		fetch:   client.FetchImage,
+		jobs:    make(chan iconJob, iconQueueSize),
+		meta:    map[uint32]iconMeta{},
+		pending: map[uint32]bool{},
+	}
+	c.load()
+	for i := 0; i < iconWorkers; i++ {
+		go c.work()
+	}
+	return c
+}
+
+func (c *iconCache) load() {
+	paths, _ := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	for _, path := range paths {
+		id, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(path), ".json"), 10, 32)
+		if err != nil {
+			continue
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var m iconMeta
+		if json.Unmarshal(raw, &m) == nil {
+			c.meta[uint32(id)] = m
+		}
+	}
+}
+
+// iconSources returns the URL an item's icon is fetched from, which is
+// also the cache key, and the site's /favicon.ico to fall back on.
+func iconSources(item Item) (source, fallback string) {
+	u, err := url.Parse(strings.TrimSpace(item.URL))
+	if err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+		fallback = u.Scheme + "://" + u.Host + "/favicon.ico"
+	}
+	if validImportURL(item.AvatarURL) {
+		return strings.TrimSpace(item.AvatarURL), fallback
+	}
+	return fallback, ""
+}
+
+// sync queues a fetch for items whose icon source changed or was never
+// fetched. It is cheap enough to run after every commit.
+func (c *iconCache) sync(items []Item) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, item := range items {
+		source, fallback := iconSources(item)
+		if m, ok := c.meta[item.ID]; ok && m.Source == source {
+			continue
+		}
+		c.queueLocked(iconJob{id: item.ID, source: source, fallback: fallback})
+	}
+}
+
+// refreshDue queues items whose icon is older than the refresh interval,
+// or whose last fetch failed longer than the retry interval ago, and drops
+// the icons of items that no longer exist.
+func (c *iconCache) refreshDue(items []Item) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	live := make(map[uint32]bool, len(items))
+	for _, item := range items {
+		live[item.ID] = true
+		source, fallback := iconSources(item)
+		m, ok := c.meta[item.ID]
+		due := !ok || m.Source != source
+		if ok && !due {
+			interval := iconRefreshInterval
+			if m.ETag == "" || m.Error != "" {
+				interval = iconRetryInterval
+			}
+			due = now.Sub(m.FetchedAt) >= interval
+		}
+		if due {
+			c.queueLocked(iconJob{id: item.ID, source: source, fallback: fallback})
+		}
+	}
+	for id := range c.meta {
+		if !live[id] && !c.pending[id] {
+			delete(c.meta, id)
+			c.removeFiles(id)
+		}
+	}
+}
+
+func (c *iconCache) queueLocked(job iconJob) {
+	if c.pending[job.id] {
+		return
+	}
+	select {
+	case c.jobs <- job:
+		c.pending[job.id] = true
+	default:
+	}
+}
+
+func (c *iconCache) work() {
+	for job := range c.jobs {
+		c.refresh(job)
+		c.mu.Lock()
+		delete(c.pending, job.id)
+		c.mu.Unlock()
+	}
+}
+
+// refresh fetches and stores one icon. A failed refresh keeps the icon
+// already stored for the same source.
+func (c *iconCache) refresh(job iconJob) {
+	var payload []byte
+	err := errUnsupportedIcon
+	if job.source != "" {
+		payload, err = c.download(job.source)
+	}
+	if err != nil && job.fallback != "" {
+		if fallback, ferr := c.download(job.fallback); ferr == nil {
+			payload, err = fallback, nil
+		}
+	}
+
+	c.mu.Lock()
+	prev, hadPrev := c.meta[job.id]
+	c.mu.Unlock()
+	next := iconMeta{Source: job.source, FetchedAt: time.Now().UTC()}
+	if err != nil {
+		next.Error = err.Error()
+		if hadPrev && prev.Source == job.source {
+			next.ETag = prev.ETag
+		} else {
+			_ = os.Remove(c.pngPath(job.id))
+		}
+	} else {
+		sum := sha256.Sum256(payload)
+		next.ETag = fmt.Sprintf(`"icon-%d-%s"`, job.id, hex.EncodeToString(sum[:8]))
+		if werr := c.writePNG(job.id, payload); werr != nil {
+			log.Printf("nav: store icon for item %d failed: %v", job.id, werr)
+			return
+		}
+	}
+	if werr := c.writeMeta(job.id, next); werr != nil {
+		log.Printf("nav: store icon for item %d failed: %v", job.id, werr)
+		return
+	}
+	c.mu.Lock()
+	c.meta[job.id] = next
+	c.mu.Unlock()
+}
+
+func (c *iconCache) download(rawURL string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), iconFetchTimeout)
+	defer cancel()
+	body, contentType, err := c.fetch(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeIcon(body, contentType)
+}
+
+// normalizeIcon checks that body is an image, both by the declared and the
+// sniffed content type, and re-encodes it as a PNG of at most iconMaxSize
+// pixels a side. Images over iconMaxDecode pixels a side are refused before
+// decoding; SVG icons are not rasterized and rejected.
+func normalizeIcon(body []byte, contentType string) ([]byte, error) {
+	declared, _, _ := mime.ParseMediaType(contentType)
+	sniffed := http.DetectContentType(body)
+	if declared != "" && declared != "application/octet-stream" && !strings.HasPrefix(declared, "image/") {
+		return nil, errUnsupportedIcon
+	}
+	if !strings.HasPrefix(sniffed, "image/") {
+		return nil, errUnsupportedIcon
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(body))
+	if err != nil || cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > iconMaxDecode || cfg.Height > iconMaxDecode {
+		return nil, errUnsupportedIcon
+	}
+	img, _, err := image.Decode(bytes.NewReader(body))
+	if err != nil {
+		return nil, errUnsupportedIcon
+	}
+	b := img.Bounds()
+	if b.Dx() > iconMaxSize || b.Dy() > iconMaxSize {
+		w, h := iconMaxSize, iconMaxSize
+		if b.Dx() > b.Dy() {
+			h = max(1, b.Dy()*iconMaxSize/b.Dx())
+		} else {
+			w = max(1, b.Dx()*iconMaxSize/b.Dy())
+		}
+		scaled := image.NewNRGBA(image.Rect(0, 0, w, h))
+		xdraw.CatmullRom.Scale(scaled, scaled.Bounds(), img, b, draw.Src, nil)
+		img = scaled
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *iconCache) pngPath(id uint32) string {
+	return filepath.Join(c.dir, strconv.FormatUint(uint64(id), 10)+".png")
+}
+
+func (c *iconCache) metaPath(id uint32) string {
+	return filepath.Join(c.dir, strconv.FormatUint(uint64(id), 10)+".json")
+}
+
+func (c *iconCache) writePNG(id uint32, payload []byte) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(c.pngPath(id), payload, 0644)
+}
+
+func (c *iconCache) writeMeta(id uint32, m iconMeta) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.metaPath(id), payload, 0644)
+}
+
+func (c *iconCache) removeFiles(id uint32) {
+	_ = os.Remove(c.pngPath(id))
+	_ = os.Remove(c.metaPath(id))
+}
+
+// get returns the stored icon for an item if it was fetched from source.
+func (c *iconCache) get(id uint32, source string) ([]byte, string, bool) {
+	c.mu.Lock()
+	m, ok := c.meta[id]
+	c.mu.Unlock()
+	if !ok || m.Source != source || m.ETag == "" {
+		return nil, "", false
+	}
+	payload, err := os.ReadFile(c.pngPath(id))
+	if err != nil {
+		return nil, "", false
+	}
+	return payload, m.ETag, true
+}
+
+// handleIcon serves the cached icon of an item, or its monogram avatar while
+// the icon is missing. Cached icons may be kept by clients for a week; use
+// /icons/{id}?v=<rev> to bust the cache when the item changes. Icons of
+// items hidden from anonymous visitors may only be cached privately.
+func (s *AppState) handleIcon(w http.ResponseWriter, r *http.Request, id uint32) {
+	w.Header().Set("Vary", "Cookie")
+	item, hidden, found := s.visibleItem(r, id)
+	if !found {
+		writeText(w, http.StatusNotFound, "not found")
+		return
+	}
+	cacheScope := "public"
+	if hidden {
+		cacheScope = "private"
+	}
+
+	source, _ := iconSources(item)
+	payload, etag, ok := s.icons.get(id, source)
+	if !ok {
+		s.icons.sync([]Item{item})
+		writeAvatar(w, r, avatarSVG(item.Name, urlHost(item.URL)), cacheScope+", max-age=300")
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d", cacheScope, int(iconCacheMaxAge.Seconds())))
+	if ifNoneMatch(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(payload)
+}
+
+func (s *AppState) refreshIcons() {
+	s.mu.Lock()
+	items := append([]Item{}, s.items...)
+	s.mu.Unlock()
+	s.icons.refreshDue(items)
+}
+
+func (s *AppState) runIconRefresher() {
+	s.refreshIcons()
+	ticker := time.NewTicker(iconCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.refreshIcons()
+	}
+}
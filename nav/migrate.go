@@ -0,0 +1,146 @@
+package nav
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// currentSchemaVersion is the DataFile layout this build reads and writes.
+// Bump it together with a new entry in migrations.
+const currentSchemaVersion = 2
+
+// migration upgrades a raw data document from version from to from+1.
+type migration struct {
+	from  int
+	name  string
+	apply func(doc map[string]json.RawMessage) error
+}
+
+var migrations = []migration{
+	{from: 0, name: "check legacy fields", apply: migrateLegacy},
+	{from: 1, name: "add record revisions", apply: migrateAddRevisions},
+}
+
+// decodeDataFile parses a data document of any known schema version,
+// upgrading it step by step. It returns the version the document had.
+func decodeDataFile(raw []byte) (DataFile, int, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return DataFile{}, 0, fmt.Errorf("corrupt data file: %w", err)
+	}
+	if doc == nil {
+		return DataFile{}, 0, fmt.Errorf("corrupt data file: not an object")
+	}
+	version, err := migrateDocument(doc)
+	if err != nil {
+		return DataFile{}, version, err
+	}
+	upgraded, err := json.Marshal(doc)
+	if err != nil {
+		return DataFile{}, version, err
+	}
+	var data DataFile
+	if err := json.Unmarshal(upgraded, &data); err != nil {
+		return DataFile{}, version, fmt.Errorf("corrupt data file: %w", err)
+	}
+	if data.NextID == 0 {
+		data.NextID = 1
+	}
+	if data.Categories == nil {
+		data.Categories = []Category{}
+	}
+	if data.Items == nil {
+		data.Items = []Item{}
+	}
+	if data.Admin.Username == "" || data.Admin.PasswordHash == "" {
+		data.Admin = defaultAdmin()
+	}
+	return data, version, nil
+}
+
+// migrateDocument runs every migration the document needs in order and
+// stamps it with currentSchemaVersion. It returns the original version.
+func migrateDocument(doc map[string]json.RawMessage) (int, error) {
+	version := 0
+	if v, ok := doc["schema_version"]; ok {
+		if err := json.Unmarshal(v, &version); err != nil {
+			return 0, fmt.Errorf("corrupt data file: invalid schema_version")
+		}
+	}
+	if version > currentSchemaVersion {
+		return version, fmt.Errorf("data file schema version %d is newer than supported version %d", version, currentSchemaVersion)
+	}
+	from := version
+	for _, m := range migrations {
+		if m.from != version {
+			continue
+		}
+		if err := m.apply(doc); err != nil {
+			return from, fmt.Errorf("migrate data from version %d (%s): %w", m.from, m.name, err)
+		}
+		version++
+	}
+	if version != currentSchemaVersion {
+		return from, fmt.Errorf("no migration path from schema version %d", version)
+	}
+	doc["schema_version"] = json.RawMessage(fmt.Sprint(currentSchemaVersion))
+	return from, nil
+}
+
+// migrateLegacy handles files written before schema_version existed. Those
+// were loaded leniently, but a field that does not decode is still corrupt
+// data: it is reported rather than dropped, so the upgraded file never
+// loses records.
+func migrateLegacy(doc map[string]json.RawMessage) error {
+	fields := []struct {
+		key    string
+		target any
+	}{
+		{"next_id", new(uint32)},
+		{"categories", new([]Category)},
+		{"items", new([]Item)},
+		{"admin", new(AdminAuth)},
+	}
+	for _, f := range fields {
+		if v, ok := doc[f.key]; ok {
+			if err := json.Unmarshal(v, f.target); err != nil {
+				return fmt.Errorf("corrupt data file: %s: %w", f.key, err)
+			}
+		}
+	}
+	return nil
+}
+
+func migrateAddRevisions(doc map[string]json.RawMessage) error {
+	for _, key := range []string{"categories", "items"} {
+		if err := updateRecords(doc, key, func(rec map[string]json.RawMessage) {
+			if _, ok := rec["rev"]; !ok {
+				rec["rev"] = json.RawMessage("1")
+			}
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateRecords applies fn to every object in the array doc[key].
+func updateRecords(doc map[string]json.RawMessage, key string, fn func(rec map[string]json.RawMessage)) error {
+	v, ok := doc[key]
+	if !ok {
+		return nil
+	}
+	var records []map[string]json.RawMessage
+	if err := json.Unmarshal(v, &records); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	for _, rec := range records {
+		fn(rec)
+	}
+	out, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	doc[key] = out
+	return nil
+}
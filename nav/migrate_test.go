@@ -0,0 +1,23 @@
+package nav
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeLegacyUndecodableField(t *testing.T) {
+	_, _, err := decodeDataFile([]byte(`{"next_id": 3, "items": "oops"}`))
+	if err == nil || !strings.Contains(err.Error(), "items") {
+		t.Fatalf("got %v, want an error naming items", err)
+	}
+}
+
+func TestDecodeLegacyFile(t *testing.T) {
+	data, version, err := decodeDataFile([]byte(`{"next_id": 3, "items": [{"id": 2, "name": "a", "url": "https://a.example/"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 0 || len(data.Items) != 1 || data.Items[0].Rev != 1 {
+		t.Fatalf("got version %d, items %+v", version, data.Items)
+	}
+}
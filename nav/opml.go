@@ -0,0 +1,137 @@
+package nav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+type opmlDocument struct {
+	XMLName xml.Name     `xml:"opml"`
+	Version string       `xml:"version,attr"`
+	Title   string       `xml:"head>title"`
+	Body    opmlOutlines `xml:"body"`
+}
+
+type opmlOutlines struct {
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+type opmlOutline struct {
+	Text        string        `xml:"text,attr"`
+	Title       string        `xml:"title,attr,omitempty"`
+	Type        string        `xml:"type,attr,omitempty"`
+	URL         string        `xml:"url,attr,omitempty"`
+	HTMLURL     string        `xml:"htmlUrl,attr,omitempty"`
+	XMLURL      string        `xml:"xmlUrl,attr,omitempty"`
+	Description string        `xml:"description,attr,omitempty"`
+	Icon        string        `xml:"icon,attr,omitempty"`
+	Outlines    []opmlOutline `xml:"outline"`
+}
+
+// writeOPML writes categories as outline groups holding one link outline
+// per item; uncategorized items follow at the top level.
+func writeOPML(w io.Writer, cats []Category, items []Item) error {
+	names := categoryNames(cats)
+	doc := opmlDocument{Version: "2.0", Title: "Nav"}
+	for _, cat := range cats {
+		group := opmlOutline{Text: cat.Name, Title: cat.Name}
+		for _, item := range items {
+			if itemInCategory(item, cat.ID, names) {
+				group.Outlines = append(group.Outlines, opmlLink(item))
+			}
+		}
+		doc.Body.Outlines = append(doc.Body.Outlines, group)
+	}
+	for _, item := range items {
+		if itemInCategory(item, 0, names) {
+			doc.Body.Outlines = append(doc.Body.Outlines, opmlLink(item))
+		}
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func opmlLink(item Item) opmlOutline {
+	return opmlOutline{
+		Text:        item.Name,
+		Title:       item.Name,
+		Type:        "link",
+		URL:         item.URL,
+		Description: item.Summary,
+		Icon:        item.AvatarURL,
+	}
+}
+
+// parseOPML reads link lists and feed reader subscriptions. An outline with
+// a URL (htmlUrl, url or xmlUrl, in that order) is an item filed under its
+// innermost enclosing outline; other outlines are categories.
+func parseOPML(body []byte) (importSet, error) {
+	var set importSet
+	var doc opmlDocument
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	dec.Strict = false
+	if err := dec.Decode(&doc); err != nil {
+		return set, errors.New("invalid opml: " + err.Error())
+	}
+
+	row := 0
+	var walk func(outlines []opmlOutline, category string)
+	walk = func(outlines []opmlOutline, category string) {
+		for _, o := range outlines {
+			name := strings.TrimSpace(o.Text)
+			if name == "" {
+				name = strings.TrimSpace(o.Title)
+			}
+			link := strings.TrimSpace(o.HTMLURL)
+			if link == "" {
+				link = strings.TrimSpace(o.URL)
+			}
+			if link == "" {
+				link = strings.TrimSpace(o.XMLURL)
+			}
+			if link == "" {
+				if name != "" {
+					set.addCategory(name)
+				}
+				sub := name
+				if sub == "" {
+					sub = category
+				}
+				walk(o.Outlines, sub)
+				continue
+			}
+
+			row++
+			if !validImportURL(link) {
+				set.addError(row, "url", "url must be an absolute http or https url")
+				continue
+			}
+			if name == "" {
+				name = link
+			}
+			set.items = append(set.items, importItem{
+				category: category,
+				item: Item{
+					Name:      name,
+					URL:       link,
+					Summary:   strings.TrimSpace(o.Description),
+					AvatarURL: strings.TrimSpace(o.Icon),
+				},
+			})
+			walk(o.Outlines, category)
+		}
+	}
+	walk(doc.Body.Outlines, "")
+	return set, nil
+}
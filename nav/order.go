@@ -0,0 +1,315 @@
+package nav
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+func sameCategory(item Item, catID *uint32) bool {
+	return sameParent(item.CategoryID, catID)
+}
+
+// siblingItems returns the IDs of the items in a category (nil for
+// uncategorized) in display order.
+func siblingItems(items []Item, catID *uint32) []uint32 {
+	var peers []Item
+	for _, item := range items {
+		if sameCategory(item, catID) {
+			peers = append(peers, item)
+		}
+	}
+	peers = sortedItems(peers)
+	out := make([]uint32, 0, len(peers))
+	for _, item := range peers {
+		out = append(out, item.ID)
+	}
+	return out
+}
+
+// siblingCategories returns the IDs of the categories under parent (nil
+// for the top level) in display order.
+func siblingCategories(cats []Category, parent *uint32) []uint32 {
+	var out []uint32
+	for _, cat := range sortedCategories(cats) {
+		if sameParent(cat.ParentID, parent) {
+			out = append(out, cat.ID)
+		}
+	}
+	return out
+}
+
+// applyOrder puts the listed IDs first, followed by the remaining
+// siblings in their current order. It reports false if ids holds a
+// duplicate or an ID that is not a sibling.
+func applyOrder(siblings, ids []uint32) ([]uint32, bool) {
+	member := make(map[uint32]bool, len(siblings))
+	for _, id := range siblings {
+		member[id] = true
+	}
+	out := make([]uint32, 0, len(siblings))
+	listed := make(map[uint32]bool, len(ids))
+	for _, id := range ids {
+		if !member[id] || listed[id] {
+			return nil, false
+		}
+		listed[id] = true
+		out = append(out, id)
+	}
+	for _, id := range siblings {
+		if !listed[id] {
+			out = append(out, id)
+		}
+	}
+	return out, true
+}
+
+// renumberItems sets Order to the position in sequence, bumping the
+// revision of every item whose order changes.
+func renumberItems(items []Item, sequence []uint32) []Item {
+	pos := make(map[uint32]int32, len(sequence))
+	for i, id := range sequence {
+		pos[id] = int32(i)
+	}
+	var changed []Item
+	for i := range items {
+		if p, ok := pos[items[i].ID]; ok && items[i].Order != p {
+			items[i].Order = p
+			items[i].Rev++
+			changed = append(changed, items[i])
+		}
+	}
+	return changed
+}
+
+func renumberCategories(cats []Category, sequence []uint32) []Category {
+	pos := make(map[uint32]int32, len(sequence))
+	for i, id := range sequence {
+		pos[id] = int32(i)
+	}
+	var changed []Category
+	for i := range cats {
+		if p, ok := pos[cats[i].ID]; ok && cats[i].Order != p {
+			cats[i].Order = p
+			cats[i].Rev++
+			changed = append(changed, cats[i])
+		}
+	}
+	return changed
+}
+
+// commitItemsLocked saves items whose changed records are listed and
+// publishes an update for each.
+func (s *AppState) commitItemsLocked(r *http.Request, action, target string, before, after any, items []Item, changed []Item) error {
+	return s.commit(func(tx StoreTx) error {
+		for _, item := range changed {
+			if err := tx.PutItem(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func() {
+		s.audit(r, action, target, before, after)
+		s.items = items
+		for _, item := range changed {
+			s.events.publish("item.updated", item)
+		}
+	})
+}
+
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, req any) bool {
+	body, err := readBody(r, 512*1024)
+	if err != nil {
+		writeText(w, http.StatusBadRequest, "invalid body")
+		return false
+	}
+	if err := json.Unmarshal(body, req); err != nil {
+		writeText(w, http.StatusBadRequest, "invalid json")
+		return false
+	}
+	return true
+}
+
+// handleReorderItems orders the items of a category (0 for uncategorized)
+// as listed; unlisted items follow in their current order. Orders are
+// renumbered from 0.
+func (s *AppState) handleReorderItems(w http.ResponseWriter, r *http.Request, id uint32) {
+	var req struct {
+		IDs []uint32 `json:"ids"`
+	}
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var catID *uint32
+	if id != 0 {
+		if !s.categoryExistsLocked(id) {
+			writeText(w, http.StatusNotFound, "not found")
+			return
+		}
+		catID = &id
+	}
+	siblings := siblingItems(s.items, catID)
+	sequence, ok := applyOrder(siblings, req.IDs)
+	if !ok {
+		writeText(w, http.StatusBadRequest, "ids must be distinct items of the category")
+		return
+	}
+	items := append([]Item{}, s.items...)
+	changed := renumberItems(items, sequence)
+	if len(changed) > 0 {
+		if err := s.commitItemsLocked(r, "items.reorder", categoryTarget(id), siblings, sequence, items, changed); err != nil {
+			writeSaveError(w, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ids": sequence})
+}
+
+// handleReorderCategories orders the children of parent_id (the top level
+// when absent) as listed.
+func (s *AppState) handleReorderCategories(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ParentID *uint32  `json:"parent_id"`
+		IDs      []uint32 `json:"ids"`
+	}
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.ParentID != nil && !s.categoryExistsLocked(*req.ParentID) {
+		writeText(w, http.StatusBadRequest, "unknown parent")
+		return
+	}
+	siblings := siblingCategories(s.categories, req.ParentID)
+	sequence, ok := applyOrder(siblings, req.IDs)
+	if !ok {
+		writeText(w, http.StatusBadRequest, "ids must be distinct categories of the parent")
+		return
+	}
+	cats := append([]Category{}, s.categories...)
+	changed := renumberCategories(cats, sequence)
+	if len(changed) > 0 {
+		target := ""
+		if req.ParentID != nil {
+			target = categoryTarget(*req.ParentID)
+		}
+		err := s.commit(func(tx StoreTx) error {
+			for _, cat := range changed {
+				if err := tx.PutCategory(cat); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, func() {
+			s.audit(r, "categories.reorder", target, siblings, sequence)
+			s.categories = cats
+			for _, cat := range changed {
+				s.events.publish("category.updated", cat)
+			}
+		})
+		if err != nil {
+			writeSaveError(w, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ids": sequence})
+}
+
+// handleMoveItem moves an item into category_id (null for uncategorized)
+// at position (the end when absent or out of range) and renumbers the
+// source and target categories.
+func (s *AppState) handleMoveItem(w http.ResponseWriter, r *http.Request, id uint32) {
+	var req struct {
+		CategoryID *uint32 `json:"category_id"`
+		Position   *int    `json:"position"`
+	}
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx := -1
+	for i := range s.items {
+		if s.items[i].ID == id {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		writeText(w, http.StatusNotFound, "not found")
+		return
+	}
+	if !ifMatch(r, itemETag(s.items[idx])) {
+		writeText(w, http.StatusPreconditionFailed, "precondition failed")
+		return
+	}
+	if req.CategoryID != nil && !s.categoryExistsLocked(*req.CategoryID) {
+		writeText(w, http.StatusBadRequest, "unknown category")
+		return
+	}
+
+	before := s.items[idx]
+	items := append([]Item{}, s.items...)
+	source := siblingItems(items, before.CategoryID)
+	items[idx].CategoryID = req.CategoryID
+	target := siblingItems(items, req.CategoryID)
+	target = removeID(target, id)
+	pos := len(target)
+	if req.Position != nil && *req.Position >= 0 && *req.Position < pos {
+		pos = *req.Position
+	}
+	target = append(target[:pos:pos], append([]uint32{id}, target[pos:]...)...)
+
+	changed := renumberItems(items, target)
+	if !sameParent(before.CategoryID, req.CategoryID) {
+		changed = append(changed, renumberItems(items, removeID(source, id))...)
+	}
+	moved := items[idx]
+	if !sameParent(before.CategoryID, moved.CategoryID) && moved.Rev == before.Rev {
+		items[idx].Rev++
+		moved = items[idx]
+		changed = append(changed, moved)
+	}
+	changed = latestItems(items, changed)
+	if len(changed) > 0 {
+		if err := s.commitItemsLocked(r, "item.move", itemTarget(id), before, moved, items, changed); err != nil {
+			writeSaveError(w, err)
+			return
+		}
+	}
+	w.Header().Set("ETag", itemETag(moved))
+	writeJSON(w, http.StatusOK, moved)
+}
+
+func removeID(ids []uint32, id uint32) []uint32 {
+	out := make([]uint32, 0, len(ids))
+	for _, v := range ids {
+		if v != id {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// latestItems returns the current version of each changed item once, in
+// ID order.
+func latestItems(items []Item, changed []Item) []Item {
+	ids := make(map[uint32]bool, len(changed))
+	for _, item := range changed {
+		ids[item.ID] = true
+	}
+	var out []Item
+	for _, item := range items {
+		if ids[item.ID] {
+			out = append(out, item)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
@@ -0,0 +1,72 @@
+package nav
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic writes payload to a temp file next to path, syncs it and
+// renames it over path, so a crash never leaves a truncated file behind.
+func writeFileAtomic(path string, payload []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	cleanup := func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmpName)
+	}
+
+	if _, err := tmp.Write(payload); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	// Windows does not support syncing directories.
+	_ = d.Sync()
+	return nil
+}
+
+// backupFile keeps raw, the current content of path, as path+".bak" when
+// it is valid JSON, so the last good copy survives a bad write.
+func backupFile(path string, raw []byte) error {
+	if len(raw) == 0 || !json.Valid(raw) {
+		return nil
+	}
+	if err := writeFileAtomic(backupPath(path), raw, 0644); err != nil {
+		return fmt.Errorf("write backup: %w", err)
+	}
+	return nil
+}
+
+func backupPath(path string) string {
+	return path + ".bak"
+}
@@ -0,0 +1,100 @@
+package nav
+
+import (
+	"sync"
+	"unicode"
+
+	"github.com/mozillazg/go-pinyin"
+)
+
+const (
+	// maxPinyinRun caps the Han characters indexed per run, since every
+	// start position yields its own tokens.
+	maxPinyinRun = 16
+	// maxPinyinVariants caps the reading combinations of polyphonic text.
+	maxPinyinVariants = 8
+)
+
+var pinyinArgs = func() pinyin.Args {
+	a := pinyin.NewArgs()
+	a.Heteronym = true
+	return a
+}()
+
+var pinyinCache sync.Map // rune -> []string
+
+// pinyinReadings returns the distinct toneless readings of r.
+func pinyinReadings(r rune) []string {
+	if v, ok := pinyinCache.Load(r); ok {
+		return v.([]string)
+	}
+	var out []string
+	for _, p := range pinyin.SinglePinyin(r, pinyinArgs) {
+		dup := false
+		for _, seen := range out {
+			dup = dup || seen == p
+		}
+		if !dup && p != "" {
+			out = append(out, p)
+		}
+	}
+	pinyinCache.Store(r, out)
+	return out
+}
+
+// pinyinTokens indexes the Han runs of s by pinyin: every syllable, and
+// from each position to the end of the run the joined syllables ("guge")
+// and initials ("gg"), so prefix matching finds any tail of a name.
+// Polyphonic characters contribute each reading. Offsets are runes of s.
+func pinyinTokens(s string) []searchToken {
+	var out []searchToken
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		var readings [][]string
+		j := i
+		for j < len(runes) && j-i < maxPinyinRun && unicode.Is(unicode.Han, runes[j]) {
+			r := pinyinReadings(runes[j])
+			if len(r) == 0 {
+				break
+			}
+			readings = append(readings, r)
+			j++
+		}
+		if j == i {
+			i++
+			continue
+		}
+		for k, rs := range readings {
+			for _, r := range rs {
+				out = append(out, searchToken{text: r, start: i + k, end: i + k + 1})
+			}
+			full, initials := []string{""}, []string{""}
+			for _, rs := range readings[k:] {
+				full = extendVariants(full, rs, func(r string) string { return r })
+				initials = extendVariants(initials, rs, func(r string) string { return r[:1] })
+			}
+			for _, v := range append(full, initials...) {
+				out = append(out, searchToken{text: v, start: i + k, end: j})
+			}
+		}
+		i = j
+	}
+	return out
+}
+
+// extendVariants appends each reading to each variant, keeping at most
+// maxPinyinVariants distinct results.
+func extendVariants(variants, readings []string, part func(string) string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, v := range variants {
+		for _, r := range readings {
+			next := v + part(r)
+			if !seen[next] && len(out) < maxPinyinVariants {
+				seen[next] = true
+				out = append(out, next)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,329 @@
+package nav
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// dataProblem describes one integrity violation in a restore payload. Path
+// names the offending field, e.g. "items[3].category_id".
+type dataProblem struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+type restoreOptions struct {
+	merge     bool
+	dryRun    bool
+	keepAdmin bool
+}
+
+func parseRestoreOptions(r *http.Request) (restoreOptions, bool) {
+	q := r.URL.Query()
+	var opts restoreOptions
+	switch q.Get("mode") {
+	case "", "replace":
+	case "merge":
+		opts.merge = true
+	default:
+		return opts, false
+	}
+	var ok1, ok2 bool
+	opts.dryRun, ok1 = queryBool(q, "dry_run", false)
+	opts.keepAdmin, ok2 = queryBool(q, "keep_admin", opts.merge)
+	return opts, ok1 && ok2
+}
+
+// validateDataFile checks a restore payload for duplicate or zero IDs,
+// a next_id that does not clear every ID, dangling category references,
+// category cycles, missing names and URLs, invalid or colliding aliases,
+// and malformed admin credentials. Items, categories and trash entries share one ID sequence.
+func validateDataFile(data DataFile, checkAdmin bool) []dataProblem {
+	problems := []dataProblem{}
+	add := func(path, format string, args ...any) {
+		problems = append(problems, dataProblem{Path: path, Error: fmt.Sprintf(format, args...)})
+	}
+	seen := map[uint32]string{}
+	useID := func(path string, id uint32) {
+		switch {
+		case id == 0:
+			add(path, "id must not be 0")
+		case seen[id] != "":
+			add(path, "duplicate id %d (also %s)", id, seen[id])
+		default:
+			seen[id] = path
+			if id >= data.NextID {
+				add(path, "id %d is not below next_id %d", id, data.NextID)
+			}
+		}
+	}
+
+	cats := map[uint32]bool{}
+	for i, cat := range data.Categories {
+		path := fmt.Sprintf("categories[%d]", i)
+		useID(path+".id", cat.ID)
+		cats[cat.ID] = true
+		if strings.TrimSpace(cat.Name) == "" {
+			add(path+".name", "name required")
+		}
+		if _, err := normalizeVisibility(cat.Visibility); err != nil {
+			add(path+".visibility", "%s", err)
+		}
+	}
+	for i, cat := range data.Categories {
+		if cat.ParentID != nil && !cats[*cat.ParentID] {
+			add(fmt.Sprintf("categories[%d].parent_id", i), "unknown category %d", *cat.ParentID)
+		}
+	}
+	for _, id := range categoryCycles(data.Categories) {
+		add(strings.TrimSuffix(seen[id], ".id")+".parent_id", "category %d is its own ancestor", id)
+	}
+	aliased := append([]Item{}, data.Items...)
+	for i, item := range data.Items {
+		path := fmt.Sprintf("items[%d]", i)
+		useID(path+".id", item.ID)
+		if strings.TrimSpace(item.Name) == "" {
+			add(path+".name", "name required")
+		}
+		if strings.TrimSpace(item.URL) == "" {
+			add(path+".url", "url required")
+		}
+		if _, err := normalizeTags(item.Tags); err != nil {
+			add(path+".tags", "%s", err)
+		}
+		if item.CategoryID != nil && !cats[*item.CategoryID] {
+			add(path+".category_id", "unknown category %d", *item.CategoryID)
+		}
+		if _, err := normalizeVisibility(item.Visibility); err != nil {
+			add(path+".visibility", "%s", err)
+		}
+		if alias, err := normalizeAlias(item.Alias, item.URL); err != nil {
+			add(path+".alias", "%s", err)
+		} else {
+			aliased[i].Alias = alias
+		}
+	}
+	for _, i := range duplicateAliases(aliased) {
+		add(fmt.Sprintf("items[%d].alias", i), "%s", errAliasInUse)
+	}
+	for i, entry := range data.Trash {
+		path := fmt.Sprintf("trash[%d]", i)
+		switch {
+		case entry.Kind == "item" && entry.Item != nil:
+		case entry.Kind == "category" && entry.Category != nil:
+		default:
+			add(path, "entry must hold the record of its kind")
+			continue
+		}
+		useID(path+".id", entry.ID)
+	}
+	if checkAdmin {
+		if strings.TrimSpace(data.Admin.Username) == "" {
+			add("admin.username", "username required")
+		}
+		if raw, err := hex.DecodeString(data.Admin.PasswordHash); err != nil || len(raw) != 32 {
+			add("admin.password_hash", "password_hash must be a hex sha256 digest")
+		}
+	}
+	return problems
+}
+
+// hasAdminHash reports whether a restore payload carries credentials;
+// decodeDataFile fills in the default admin when it does not.
+func hasAdminHash(raw []byte) bool {
+	var probe struct {
+		Admin struct {
+			PasswordHash string `json:"password_hash"`
+		} `json:"admin"`
+	}
+	return json.Unmarshal(raw, &probe) == nil && probe.Admin.PasswordHash != ""
+}
+
+// mergeDataLocked upserts the records of data into the current state.
+// Records are matched by ID, then categories by name and items by URL;
+// unmatched records get fresh IDs. Nothing is deleted and the trash is
+// kept.
+func (s *AppState) mergeDataLocked(data DataFile) DataFile {
+	out := s.dataLocked()
+	out.Categories = append([]Category{}, out.Categories...)
+	out.Items = append([]Item{}, out.Items...)
+	out.NextID = max(out.NextID, data.NextID)
+	out.Admin = data.Admin
+
+	catIndex := map[uint32]int{}
+	catByName := map[string]int{}
+	for i, cat := range out.Categories {
+		catIndex[cat.ID] = i
+		catByName[strings.ToLower(strings.TrimSpace(cat.Name))] = i
+	}
+	catIDs := map[uint32]uint32{}
+	var merged []int
+	for _, in := range data.Categories {
+		i, ok := catIndex[in.ID]
+		if !ok {
+			i, ok = catByName[strings.ToLower(strings.TrimSpace(in.Name))]
+		}
+		if !ok {
+			incoming := in.ID
+			in.ID = out.NextID
+			out.NextID++
+			in.Rev = 1
+			catIDs[incoming] = in.ID
+			merged = append(merged, len(out.Categories))
+			out.Categories = append(out.Categories, in)
+			continue
+		}
+		catIDs[in.ID] = out.Categories[i].ID
+		in.ID = out.Categories[i].ID
+		in.Rev = out.Categories[i].Rev
+		out.Categories[i] = in
+		merged = append(merged, i)
+	}
+	for _, i := range merged {
+		if parent := out.Categories[i].ParentID; parent != nil {
+			id := catIDs[*parent]
+			out.Categories[i].ParentID = &id
+		}
+	}
+
+	itemIndex := map[uint32]int{}
+	itemByURL := map[string]int{}
+	for i, item := range out.Items {
+		itemIndex[item.ID] = i
+		itemByURL[normalizeURL(item.URL)] = i
+	}
+	for _, in := range data.Items {
+		if in.CategoryID != nil {
+			id := catIDs[*in.CategoryID]
+			in.CategoryID = &id
+		}
+		i, ok := itemIndex[in.ID]
+		if !ok {
+			i, ok = itemByURL[normalizeURL(in.URL)]
+		}
+		if !ok {
+			in.ID = out.NextID
+			out.NextID++
+			in.Rev = 1
+			itemByURL[normalizeURL(in.URL)] = len(out.Items)
+			out.Items = append(out.Items, in)
+			continue
+		}
+		in.ID = out.Items[i].ID
+		in.Rev = out.Items[i].Rev
+		out.Items[i] = in
+	}
+	s.bumpRevsLocked(&out)
+	return out
+}
+
+// keptTrashLocked returns the current trash entries that survive a restore
+// which carries no trash of its own. Entries whose record is brought back
+// by the restore are dropped.
+func (s *AppState) keptTrashLocked(data DataFile) []TrashEntry {
+	restored := map[uint32]bool{}
+	for _, cat := range data.Categories {
+		restored[cat.ID] = true
+	}
+	for _, item := range data.Items {
+		restored[item.ID] = true
+	}
+	out := []TrashEntry{}
+	for _, entry := range s.trash {
+		if !restored[entry.ID] {
+			out = append(out, entry)
+		}
+	}
+	return out
+}
+
+// handleRestore replaces (or with mode=merge, upserts into) the stored data.
+// The payload is validated first; dry_run=1 reports the resulting diff
+// without saving.
+func (s *AppState) handleRestore(w http.ResponseWriter, r *http.Request) {
+	opts, ok := parseRestoreOptions(r)
+	if !ok {
+		writeText(w, http.StatusBadRequest, "invalid options")
+		return
+	}
+	body, err := readBody(r, 5*1024*1024)
+	if err != nil {
+		writeText(w, http.StatusBadRequest, "invalid body")
+		return
+	}
+	data, _, err := decodeDataFile(body)
+	if err != nil {
+		writeText(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	keepAdmin := opts.keepAdmin || !hasAdminHash(body)
+	if problems := validateDataFile(data, !keepAdmin); len(problems) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"errors": problems})
+		return
+	}
+	for i := range data.Items {
+		data.Items[i].Tags, _ = normalizeTags(data.Items[i].Tags)
+		data.Items[i].Alias, _ = normalizeAlias(data.Items[i].Alias, data.Items[i].URL)
+		data.Items[i].Visibility, _ = normalizeVisibility(data.Items[i].Visibility)
+	}
+	for i := range data.Categories {
+		data.Categories[i].Visibility, _ = normalizeVisibility(data.Categories[i].Visibility)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !ifMatch(r, s.dataETagLocked()) {
+		writeText(w, http.StatusPreconditionFailed, "precondition failed")
+		return
+	}
+	if keepAdmin {
+		data.Admin = s.admin
+	}
+	if opts.merge {
+		data = s.mergeDataLocked(data)
+		if cycles := categoryCycles(data.Categories); len(cycles) > 0 {
+			writeText(w, http.StatusConflict, "merge would create a category cycle")
+			return
+		}
+		if len(duplicateAliases(data.Items)) > 0 {
+			writeText(w, http.StatusConflict, "merge would create duplicate aliases")
+			return
+		}
+	} else {
+		s.bumpRevsLocked(&data)
+		if data.Trash == nil {
+			data.Trash = s.keptTrashLocked(data)
+			data.NextID = max(data.NextID, s.nextID)
+		}
+	}
+	mode := "replace"
+	if opts.merge {
+		mode = "merge"
+	}
+	current := s.dataLocked()
+	if opts.dryRun {
+		writeJSON(w, http.StatusOK, map[string]any{"dry_run": true, "mode": mode, "diff": diffData(current, data)})
+		return
+	}
+
+	before := dataSummary(current)
+	err = s.commitBulk(func(tx StoreTx) error {
+		return tx.Replace(data)
+	}, func() {
+		s.audit(r, "data.restore", "", before, dataSummary(data))
+		s.nextID = data.NextID
+		s.items = data.Items
+		s.categories = data.Categories
+		s.admin = data.Admin
+		s.trash = data.Trash
+		s.events.publish(eventTypeRestored, map[string]string{"reason": "restore"})
+	})
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "mode": mode})
+}
@@ -0,0 +1,570 @@
+package nav
+
+import (
+	"html"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Searchable fields of an item, with their ranking weights.
+const (
+	fieldName = iota
+	fieldHost
+	fieldTags
+	fieldCategory
+	fieldSummary
+	fieldNamePinyin
+	fieldCategoryPinyin
+	numSearchFields
+)
+
+// Pinyin fields index the Chinese name and category by pinyin; their
+// matches are highlighted in the name and category.
+var (
+	searchFieldNames   = [numSearchFields]string{"name", "host", "tags", "category", "summary", "name", "category"}
+	searchFieldWeights = [numSearchFields]float64{4, 3, 2, 2, 1, 3, 1.5}
+)
+
+func fieldTokens(f int, text string) []searchToken {
+	if f == fieldNamePinyin || f == fieldCategoryPinyin {
+		return pinyinTokens(text)
+	}
+	return tokenize(text)
+}
+
+type searchToken struct {
+	text       string
+	start, end int // rune offsets in the field
+	unigram    bool
+}
+
+// tokenize lowercases s and splits it into words. Han characters have no
+// word boundaries, so each one is a unigram token and every adjacent pair
+// a bigram token as well.
+func tokenize(s string) []searchToken {
+	var out []searchToken
+	runes := []rune(strings.ToLower(s))
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.Is(unicode.Han, r):
+			out = append(out, searchToken{text: string(r), start: i, end: i + 1, unigram: true})
+			if i+1 < len(runes) && unicode.Is(unicode.Han, runes[i+1]) {
+				out = append(out, searchToken{text: string(runes[i : i+2]), start: i, end: i + 2})
+			}
+			i++
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j])) && !unicode.Is(unicode.Han, runes[j]) {
+				j++
+			}
+			out = append(out, searchToken{text: string(runes[i:j]), start: i, end: j})
+			i = j
+		default:
+			i++
+		}
+	}
+	return out
+}
+
+// queryTerms tokenizes a query. A run of several Han characters is matched
+// by its bigrams only, so that all of them have to appear in order.
+func queryTerms(q string) []string {
+	tokens := tokenize(q)
+	inBigram := map[int]bool{}
+	for _, t := range tokens {
+		if t.end-t.start == 2 && !t.unigram && unicode.Is(unicode.Han, []rune(t.text)[0]) {
+			inBigram[t.start], inBigram[t.start+1] = true, true
+		}
+	}
+	var out []string
+	seen := map[string]bool{}
+	for _, t := range tokens {
+		if t.unigram && inBigram[t.start] || seen[t.text] {
+			continue
+		}
+		seen[t.text] = true
+		out = append(out, t.text)
+	}
+	return out
+}
+
+func urlHost(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+type searchDoc struct {
+	item     Item
+	category uint32
+	fields   [numSearchFields]string
+	terms    []string
+	key      string
+}
+
+// searchIndex is an inverted index over the items, kept in step with the
+// state by sync after every commit and reload. Category names are indexed
+// once per category and matched to items through members.
+type searchIndex struct {
+	mu          sync.RWMutex
+	docs        map[uint32]*searchDoc
+	postings    *postingList
+	categories  map[uint32]*searchDoc
+	catPostings *postingList
+	catMembers  map[uint32]map[uint32]bool
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		docs:        map[uint32]*searchDoc{},
+		postings:    newPostingList(),
+		categories:  map[uint32]*searchDoc{},
+		catPostings: newPostingList(),
+		catMembers:  map[uint32]map[uint32]bool{},
+	}
+}
+
+func searchFields(item Item) [numSearchFields]string {
+	var f [numSearchFields]string
+	f[fieldName] = item.Name
+	f[fieldHost] = urlHost(item.URL)
+	f[fieldTags] = strings.Join(item.Tags, " ")
+	f[fieldSummary] = item.Summary
+	f[fieldNamePinyin] = item.Name
+	return f
+}
+
+// sync re-indexes the items and categories whose searchable fields
+// changed and drops the ones that are gone. Every change bumps an item's
+// revision, so items with an unchanged revision are skipped cheaply.
+func (x *searchIndex) sync(items []Item, cats []Category) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	liveCats := make(map[uint32]bool, len(cats))
+	for _, cat := range cats {
+		liveCats[cat.ID] = true
+		if doc, ok := x.categories[cat.ID]; ok && doc.key == cat.Name {
+			continue
+		}
+		x.removeCategoryLocked(cat.ID)
+		var fields [numSearchFields]string
+		fields[fieldCategory] = cat.Name
+		fields[fieldCategoryPinyin] = cat.Name
+		doc := &searchDoc{category: cat.ID, fields: fields, key: cat.Name}
+		doc.terms = addPostings(x.catPostings, cat.ID, fields)
+		x.categories[cat.ID] = doc
+	}
+	for id := range x.categories {
+		if !liveCats[id] {
+			x.removeCategoryLocked(id)
+		}
+	}
+
+	live := make(map[uint32]bool, len(items))
+	for _, item := range items {
+		live[item.ID] = true
+		var category uint32
+		if item.CategoryID != nil {
+			category = *item.CategoryID
+		}
+		doc, ok := x.docs[item.ID]
+		if ok && doc.item.Rev == item.Rev && doc.category == category {
+			doc.item = item
+			continue
+		}
+		fields := searchFields(item)
+		key := strings.Join(fields[:], "\x00")
+		if ok && doc.key == key && doc.category == category {
+			doc.item = item
+			continue
+		}
+		x.removeLocked(item.ID)
+		doc = &searchDoc{item: item, category: category, fields: fields, key: key}
+		doc.terms = addPostings(x.postings, item.ID, fields)
+		x.docs[item.ID] = doc
+		if x.catMembers[category] == nil {
+			x.catMembers[category] = map[uint32]bool{}
+		}
+		x.catMembers[category][item.ID] = true
+	}
+	for id := range x.docs {
+		if !live[id] {
+			x.removeLocked(id)
+		}
+	}
+}
+
+// postingList maps each indexed term to the records containing it and a
+// mask of the fields it appears in. Terms are also grouped by rune length
+// and by their first two runes, so that matching a query term only rates
+// the terms that can match it: those of a length within the typo
+// tolerance, and those sharing its head for prefix matches.
+type postingList struct {
+	terms  map[string]map[uint32]uint8
+	byLen  map[int]map[string]bool
+	byHead map[string]map[string]bool
+}
+
+func newPostingList() *postingList {
+	return &postingList{
+		terms:  map[string]map[uint32]uint8{},
+		byLen:  map[int]map[string]bool{},
+		byHead: map[string]map[string]bool{},
+	}
+}
+
+// termHead returns the first two runes of a term, which every term it is
+// a prefix of shares.
+func termHead(term string) string {
+	i := 0
+	for n := 0; n < 2 && i < len(term); n++ {
+		_, size := utf8.DecodeRuneInString(term[i:])
+		i += size
+	}
+	return term[:i]
+}
+
+func (p *postingList) add(term string, id uint32, mask uint8) {
+	ids := p.terms[term]
+	if ids == nil {
+		ids = map[uint32]uint8{}
+		p.terms[term] = ids
+		n, head := utf8.RuneCountInString(term), termHead(term)
+		if p.byLen[n] == nil {
+			p.byLen[n] = map[string]bool{}
+		}
+		p.byLen[n][term] = true
+		if p.byHead[head] == nil {
+			p.byHead[head] = map[string]bool{}
+		}
+		p.byHead[head][term] = true
+	}
+	ids[id] = mask
+}
+
+func (p *postingList) remove(term string, id uint32) {
+	ids := p.terms[term]
+	if ids == nil {
+		return
+	}
+	delete(ids, id)
+	if len(ids) > 0 {
+		return
+	}
+	delete(p.terms, term)
+	n, head := utf8.RuneCountInString(term), termHead(term)
+	delete(p.byLen[n], term)
+	if len(p.byLen[n]) == 0 {
+		delete(p.byLen, n)
+	}
+	delete(p.byHead[head], term)
+	if len(p.byHead[head]) == 0 {
+		delete(p.byHead, head)
+	}
+}
+
+// match calls fn with every term that matches the query term q, its
+// quality and its postings.
+func (p *postingList) match(q string, fn func(term string, quality float64, ids map[uint32]uint8)) {
+	seen := map[string]bool{}
+	try := func(term string) {
+		if seen[term] {
+			return
+		}
+		seen[term] = true
+		if quality := termQuality(q, term); quality > 0 {
+			fn(term, quality, p.terms[term])
+		}
+	}
+	if _, ok := p.terms[q]; ok {
+		try(q)
+	}
+	qn := utf8.RuneCountInString(q)
+	if qn >= 2 {
+		for term := range p.byHead[termHead(q)] {
+			try(term)
+		}
+	}
+	if k := maxEdits(qn); k > 0 {
+		for n := qn - k; n <= qn+k; n++ {
+			for term := range p.byLen[n] {
+				try(term)
+			}
+		}
+	}
+}
+
+// addPostings indexes the tokens of fields under id and returns the terms.
+func addPostings(postings *postingList, id uint32, fields [numSearchFields]string) []string {
+	masks := map[string]uint8{}
+	for f, text := range fields {
+		for _, t := range fieldTokens(f, text) {
+			masks[t.text] |= 1 << f
+		}
+	}
+	terms := make([]string, 0, len(masks))
+	for term, mask := range masks {
+		terms = append(terms, term)
+		postings.add(term, id, mask)
+	}
+	return terms
+}
+
+func removePostings(postings *postingList, id uint32, terms []string) {
+	for _, term := range terms {
+		postings.remove(term, id)
+	}
+}
+
+func (x *searchIndex) removeLocked(id uint32) {
+	doc, ok := x.docs[id]
+	if !ok {
+		return
+	}
+	removePostings(x.postings, id, doc.terms)
+	delete(x.catMembers[doc.category], id)
+	delete(x.docs, id)
+}
+
+func (x *searchIndex) removeCategoryLocked(id uint32) {
+	if doc, ok := x.categories[id]; ok {
+		removePostings(x.catPostings, id, doc.terms)
+		delete(x.categories, id)
+	}
+}
+
+// maxEdits is the typo tolerance for a query term of n runes.
+func maxEdits(n int) int {
+	switch {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// termQuality rates how well an indexed term matches a query term: 1 for
+// an exact match, less for a prefix or a match within the typo tolerance,
+// 0 for no match.
+func termQuality(query, term string) float64 {
+	if term == query {
+		return 1
+	}
+	qn := utf8.RuneCountInString(query)
+	if qn >= 2 && strings.HasPrefix(term, query) {
+		return 0.8
+	}
+	k := maxEdits(qn)
+	if k == 0 {
+		return 0
+	}
+	tn := utf8.RuneCountInString(term)
+	if tn < qn-k || tn > qn+k {
+		return 0
+	}
+	d := editDistance([]rune(query), []rune(term), k)
+	if d > k {
+		return 0
+	}
+	return 0.7 - 0.15*float64(d-1)
+}
+
+// editDistance returns the Levenshtein distance of a and b, or k+1 once it
+// is known to exceed k.
+func editDistance(a, b []rune, k int) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		best := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			best = min(best, cur[j])
+		}
+		if best > k {
+			return k + 1
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+type searchHit struct {
+	Item       Item              `json:"item"`
+	Category   string            `json:"category,omitempty"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// search returns the items matching every query term, best first, and
+// the total number of matches. Items in hidden are left out.
+func (x *searchIndex) search(q string, offset, limit int, hidden map[uint32]bool) ([]searchHit, int) {
+	terms := queryTerms(q)
+	if len(terms) == 0 {
+		return []searchHit{}, 0
+	}
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	var scores map[uint32]float64
+	matched := map[string]bool{}
+	for _, qt := range terms {
+		termScores := map[uint32]float64{}
+		score := func(id uint32, quality float64, mask uint8) {
+			for f := 0; f < numSearchFields; f++ {
+				if mask&(1<<f) != 0 {
+					termScores[id] = max(termScores[id], quality*searchFieldWeights[f])
+				}
+			}
+		}
+		x.postings.match(qt, func(term string, quality float64, ids map[uint32]uint8) {
+			matched[term] = true
+			for id, mask := range ids {
+				score(id, quality, mask)
+			}
+		})
+		x.catPostings.match(qt, func(term string, quality float64, cats map[uint32]uint8) {
+			matched[term] = true
+			for catID, mask := range cats {
+				for id := range x.catMembers[catID] {
+					score(id, quality, mask)
+				}
+			}
+		})
+		if scores == nil {
+			scores = termScores
+			continue
+		}
+		for id := range scores {
+			if s, ok := termScores[id]; ok {
+				scores[id] += s
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	lq := strings.ToLower(strings.TrimSpace(q))
+	ids := make([]uint32, 0, len(scores))
+	for id := range scores {
+		if hidden[id] {
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(x.docs[id].fields[fieldName]), lq) {
+			scores[id]++
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := ids[i], ids[j]
+		if scores[a] != scores[b] {
+			return scores[a] > scores[b]
+		}
+		if la, lb := len(x.docs[a].fields[fieldName]), len(x.docs[b].fields[fieldName]); la != lb {
+			return la < lb
+		}
+		return a < b
+	})
+
+	total := len(ids)
+	start := min(offset, total)
+	end := start + min(limit, total-start)
+	hits := []searchHit{}
+	for _, id := range ids[start:end] {
+		doc := x.docs[id]
+		fields := doc.fields
+		if cat := x.categories[doc.category]; cat != nil {
+			fields[fieldCategory] = cat.fields[fieldCategory]
+			fields[fieldCategoryPinyin] = cat.fields[fieldCategoryPinyin]
+		}
+		hit := searchHit{Item: doc.item, Category: fields[fieldCategory], Score: math.Round(scores[id]*1000) / 1000, Highlights: map[string]string{}}
+		texts := map[string]string{}
+		tokens := map[string][]searchToken{}
+		for f, text := range fields {
+			name := searchFieldNames[f]
+			texts[name] = text
+			tokens[name] = append(tokens[name], fieldTokens(f, text)...)
+		}
+		for name, text := range texts {
+			if marked, ok := highlight(text, tokens[name], matched); ok {
+				hit.Highlights[name] = marked
+			}
+		}
+		hits = append(hits, hit)
+	}
+	return hits, total
+}
+
+// highlight HTML-escapes text and wraps the tokens in matched with <mark>.
+func highlight(text string, tokens []searchToken, matched map[string]bool) (string, bool) {
+	runes := []rune(text)
+	marks := make([]bool, len(runes))
+	found := false
+	for _, t := range tokens {
+		if matched[t.text] {
+			found = true
+			for i := t.start; i < t.end; i++ {
+				marks[i] = true
+			}
+		}
+	}
+	if !found {
+		return "", false
+	}
+	var b strings.Builder
+	for i := 0; i < len(runes); {
+		j := i
+		for j < len(runes) && marks[j] == marks[i] {
+			j++
+		}
+		segment := html.EscapeString(string(runes[i:j]))
+		if marks[i] {
+			b.WriteString("<mark>" + segment + "</mark>")
+		} else {
+			b.WriteString(segment)
+		}
+		i = j
+	}
+	return b.String(), true
+}
+
+func (s *AppState) handleSearch(w http.ResponseWriter, r *http.Request) {
+	offset, limit, ok := parsePaging(w, r, 20, 100)
+	if !ok {
+		return
+	}
+	q := r.URL.Query().Get("q")
+	var hidden map[uint32]bool
+	if _, admin := s.sessionUserFor(r); !admin {
+		s.mu.Lock()
+		hidden = s.hiddenItemIDsLocked()
+		s.mu.Unlock()
+	}
+	hits, total := s.search.search(q, offset, limit, hidden)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"query":   q,
+		"total":   total,
+		"offset":  offset,
+		"limit":   limit,
+		"results": hits,
+	})
+}
@@ -0,0 +1,60 @@
+package nav
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSearchOffsetOutOfRange(t *testing.T) {
+	x := newSearchIndex()
+	x.sync([]Item{
+		{ID: 1, Name: "GitHub", URL: "https://github.com/"},
+		{ID: 2, Name: "GitHub Docs", URL: "https://docs.github.com/"},
+	}, nil)
+
+	for _, offset := range []int{2, 3, math.MaxInt - 8} {
+		hits, total := x.search("github", offset, 100, nil)
+		if total != 2 || len(hits) != 0 {
+			t.Errorf("offset %d: got %d hits of %d, want 0 of 2", offset, len(hits), total)
+		}
+	}
+	if hits, _ := x.search("github", 1, math.MaxInt, nil); len(hits) != 1 {
+		t.Errorf("offset 1: got %d hits, want 1", len(hits))
+	}
+}
+
+func TestPostingListMatchesLikeFullScan(t *testing.T) {
+	p := newPostingList()
+	terms := []string{"github", "gitlab", "git", "grafana", "graphana", "jenkins", "jenkin", "kubernetes",
+		"kubernets", "docs", "doc", "谷歌", "谷", "gu", "guge", "documentation", "a"}
+	for i, term := range terms {
+		p.add(term, uint32(i+1), 1)
+	}
+	p.remove("gitlab", 2)
+
+	for _, q := range []string{"git", "githb", "gi", "grafana", "kubernetes", "jenkins", "doc", "docu", "谷", "gu", "a", "x", "documentatoin"} {
+		want := map[string]float64{}
+		for term := range p.terms {
+			if quality := termQuality(q, term); quality > 0 {
+				want[term] = quality
+			}
+		}
+		got := map[string]float64{}
+		p.match(q, func(term string, quality float64, ids map[uint32]uint8) {
+			got[term] = quality
+		})
+		if len(got) != len(want) {
+			t.Errorf("%q: got %v, want %v", q, got, want)
+			continue
+		}
+		for term, quality := range want {
+			if got[term] != quality {
+				t.Errorf("%q: got %v, want %v", q, got, want)
+				break
+			}
+		}
+	}
+	if _, ok := p.byLen[6]["gitlab"]; ok {
+		t.Error("removed term still bucketed")
+	}
+}
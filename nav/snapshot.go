@@ -0,0 +1,294 @@
+package nav
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSnapshotKeep = 20
+	snapshotInterval    = 5 * time.Minute
+	snapshotTimeFormat  = "20060102T150405.000000000Z"
+)
+
+var errSnapshotNotFound = errors.New("snapshot not found")
+
+type SnapshotInfo struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	Size int64     `json:"size"`
+}
+
+// snapshotter keeps the last keep copies of the nav data as timestamped
+// JSON files in dir. A nil snapshotter is disabled.
+//
+// Commits only mark the data dirty; a snapshot is written at most every
+// snapshotInterval, and around bulk changes (see commitBulk), so a burst of
+// small edits does not cycle out the retained history.
+type snapshotter struct {
+	dir  string
+	keep int
+
+	mu    sync.Mutex
+	dirty bool
+}
+
+func newSnapshotter(dir string, keep int) *snapshotter {
+	if keep < 0 {
+		return nil
+	}
+	if keep == 0 {
+		keep = defaultSnapshotKeep
+	}
+	return &snapshotter{dir: dir, keep: keep}
+}
+
+// markDirty records that the data changed since the last snapshot.
+func (sn *snapshotter) markDirty() {
+	if sn == nil {
+		return
+	}
+	sn.mu.Lock()
+	sn.dirty = true
+	sn.mu.Unlock()
+}
+
+// claim reports whether the data changed since the last snapshot and
+// clears the mark, so the caller is the one to take it.
+func (sn *snapshotter) claim() bool {
+	if sn == nil {
+		return false
+	}
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+	dirty := sn.dirty
+	sn.dirty = false
+	return dirty
+}
+
+// take writes data as a new snapshot and prunes old ones. Failures are
+// logged rather than returned: the change itself is already saved.
+func (sn *snapshotter) take(data DataFile) {
+	if sn == nil {
+		return
+	}
+	payload, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		log.Printf("nav: snapshot failed: %v", err)
+		return
+	}
+	sn.save(payload)
+}
+
+// save writes an encoded snapshot and prunes old ones.
+func (sn *snapshotter) save(payload []byte) {
+	if err := sn.write(payload); err != nil {
+		log.Printf("nav: snapshot failed: %v", err)
+		return
+	}
+	if err := sn.prune(); err != nil {
+		log.Printf("nav: snapshot prune failed: %v", err)
+	}
+}
+
+func (sn *snapshotter) write(payload []byte) error {
+	if err := os.MkdirAll(sn.dir, 0755); err != nil {
+		return err
+	}
+	id := time.Now().UTC().Format(snapshotTimeFormat)
+	return writeFileAtomic(filepath.Join(sn.dir, id+".json"), payload, 0644)
+}
+
+func (sn *snapshotter) prune() error {
+	list, err := sn.list()
+	if err != nil {
+		return err
+	}
+	for i := sn.keep; i < len(list); i++ {
+		if err := os.Remove(filepath.Join(sn.dir, list[i].ID+".json")); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// list returns the snapshots newest first.
+func (sn *snapshotter) list() ([]SnapshotInfo, error) {
+	out := []SnapshotInfo{}
+	if sn == nil {
+		return out, nil
+	}
+	entries, err := os.ReadDir(sn.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return out, nil
+		}
+		return nil, err
+	}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		ts, err := time.Parse(snapshotTimeFormat, id)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		out = append(out, SnapshotInfo{ID: id, Time: ts, Size: info.Size()})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Time.After(out[j].Time) })
+	return out, nil
+}
+
+func (sn *snapshotter) load(id string) (DataFile, error) {
+	if sn == nil {
+		return DataFile{}, errSnapshotNotFound
+	}
+	if _, err := time.Parse(snapshotTimeFormat, id); err != nil {
+		return DataFile{}, errSnapshotNotFound
+	}
+	raw, err := os.ReadFile(filepath.Join(sn.dir, id+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return DataFile{}, errSnapshotNotFound
+		}
+		return DataFile{}, err
+	}
+	data, _, err := decodeDataFile(raw)
+	if err != nil {
+		return DataFile{}, fmt.Errorf("snapshot %s: %w", id, err)
+	}
+	return data, nil
+}
+
+// flushSnapshotLocked takes a snapshot now if the data changed since the
+// last one.
+func (s *AppState) flushSnapshotLocked() {
+	if s.snapshots.claim() {
+		s.snapshots.take(s.dataLocked())
+	}
+}
+
+// commitBulk is commit for restores, imports, rollbacks and batches. Changes
+// not yet snapshotted are snapshotted first and the result right after, so
+// every bulk change can be rolled back on its own. Callers must hold s.mu.
+func (s *AppState) commitBulk(persist func(tx StoreTx) error, apply func()) error {
+	s.flushSnapshotLocked()
+	if err := s.commit(persist, apply); err != nil {
+		return err
+	}
+	s.flushSnapshotLocked()
+	return nil
+}
+
+// runSnapshotter snapshots pending changes every snapshotInterval. The data
+// is encoded under the lock but written outside it.
+func (s *AppState) runSnapshotter() {
+	ticker := time.NewTicker(snapshotInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.mu.Lock()
+		if !s.snapshots.claim() {
+			s.mu.Unlock()
+			continue
+		}
+		payload, err := json.MarshalIndent(s.dataLocked(), "", "  ")
+		s.mu.Unlock()
+		if err != nil {
+			log.Printf("nav: snapshot failed: %v", err)
+			continue
+		}
+		s.snapshots.save(payload)
+	}
+}
+
+func (s *AppState) handleListSnapshots(w http.ResponseWriter) {
+	list, err := s.snapshots.list()
+	if err != nil {
+		writeText(w, http.StatusInternalServerError, "list snapshots failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *AppState) loadSnapshot(w http.ResponseWriter, id string) (DataFile, bool) {
+	data, err := s.snapshots.load(id)
+	if errors.Is(err, errSnapshotNotFound) {
+		writeText(w, http.StatusNotFound, "not found")
+		return DataFile{}, false
+	}
+	if err != nil {
+		writeText(w, http.StatusInternalServerError, "load snapshot failed")
+		return DataFile{}, false
+	}
+	return data, true
+}
+
+func (s *AppState) handleSnapshotDiff(w http.ResponseWriter, id string) {
+	data, ok := s.loadSnapshot(w, id)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	diff := diffData(s.dataLocked(), s.rollbackDataLocked(data))
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, diff)
+}
+
+// rollbackDataLocked prepares a snapshot for restoring: the current admin
+// credentials are kept so a rollback never locks anyone out, and the ID
+// counter never moves backwards. A snapshot without trash keeps the current
+// trash, less the entries whose records it brings back.
+func (s *AppState) rollbackDataLocked(data DataFile) DataFile {
+	data.Admin = s.admin
+	if data.NextID < s.nextID {
+		data.NextID = s.nextID
+	}
+	if data.Trash == nil {
+		data.Trash = s.keptTrashLocked(data)
+	}
+	data.Categories = append([]Category{}, data.Categories...)
+	data.Items = append([]Item{}, data.Items...)
+	s.bumpRevsLocked(&data)
+	return data
+}
+
+func (s *AppState) handleRollback(w http.ResponseWriter, r *http.Request, id string) {
+	data, ok := s.loadSnapshot(w, id)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	data = s.rollbackDataLocked(data)
+	before := dataSummary(s.dataLocked())
+	err := s.commitBulk(func(tx StoreTx) error {
+		return tx.Replace(data)
+	}, func() {
+		s.audit(r, "snapshot.rollback", "snapshot:"+id, before, dataSummary(data))
+		s.nextID = data.NextID
+		s.items = data.Items
+		s.categories = data.Categories
+		s.trash = data.Trash
+		s.events.publish(eventTypeRestored, map[string]string{"reason": "rollback", "snapshot": id})
+	})
+	s.mu.Unlock()
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
@@ -0,0 +1,65 @@
+package nav
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestRollbackDropsTrashOfRestoredItems(t *testing.T) {
+	c := newTestClient(t)
+	w := c.do("POST", "/api/item", `{"name":"a","url":"https://a.invalid/"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body)
+	}
+	var item Item
+	c.decode(w, &item)
+
+	state := c.app.state
+	state.mu.Lock()
+	state.flushSnapshotLocked()
+	state.mu.Unlock()
+	var list []SnapshotInfo
+	c.decode(c.do("GET", "/api/snapshots", ""), &list)
+	if len(list) == 0 {
+		t.Fatal("no snapshot taken")
+	}
+	snapshot := list[0].ID
+
+	if w := c.do("DELETE", fmt.Sprintf("/api/item/%d", item.ID), ""); w.Code != http.StatusOK && w.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d %s", w.Code, w.Body)
+	}
+	if w := c.do("POST", "/api/snapshots/"+snapshot+"/restore", ""); w.Code != http.StatusOK {
+		t.Fatalf("rollback: %d %s", w.Code, w.Body)
+	}
+
+	var trash []TrashEntry
+	c.decode(c.do("GET", "/api/trash", ""), &trash)
+	if len(trash) != 0 {
+		t.Fatalf("trash after rollback: got %d entries, want 0", len(trash))
+	}
+	if w := c.do("POST", fmt.Sprintf("/api/trash/%d/restore", item.ID), ""); w.Code == http.StatusOK {
+		t.Fatalf("restore from trash after rollback: got %d", w.Code)
+	}
+	state.mu.Lock()
+	n := len(state.items)
+	state.mu.Unlock()
+	if n != 1 {
+		t.Fatalf("items after rollback: got %d, want 1", n)
+	}
+}
+
+func TestRestoreTrashLiveID(t *testing.T) {
+	c := newTestClient(t)
+	var item Item
+	c.decode(c.do("POST", "/api/item", `{"name":"a","url":"https://a.invalid/"}`), &item)
+
+	state := c.app.state
+	state.mu.Lock()
+	state.trash = append(state.trash, TrashEntry{ID: item.ID, Kind: trashKindItem, Item: &item})
+	state.mu.Unlock()
+
+	if w := c.do("POST", fmt.Sprintf("/api/trash/%d/restore", item.ID), ""); w.Code != http.StatusConflict {
+		t.Fatalf("restore live id: got %d, want %d", w.Code, http.StatusConflict)
+	}
+}
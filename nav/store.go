@@ -0,0 +1,47 @@
+package nav
+
+import "strings"
+
+// Store persists nav data. Mutations go through Update so a handler's
+// changes are written together or not at all.
+type Store interface {
+	Load() (DataFile, error)
+	Update(fn func(tx StoreTx) error) error
+
+	Sessions() (map[string]string, error)
+	SaveSession(token, username string) error
+	DeleteSession(token string) error
+}
+
+type StoreTx interface {
+	PutCategory(cat Category) error
+	DeleteCategory(id uint32) error
+	PutItem(item Item) error
+	DeleteItem(id uint32) error
+	SetAdmin(admin AdminAuth) error
+	SetNextID(next uint32) error
+	PutTrash(entry TrashEntry) error
+	DeleteTrash(id uint32) error
+	Replace(data DataFile) error
+}
+
+// openStore picks a backend from the --nav-data value: "sqlite://<path>"
+// opens an SQLite database, anything else is treated as a JSON file path.
+func openStore(dsn string) (Store, error) {
+	if path, ok := strings.CutPrefix(dsn, "sqlite://"); ok {
+		return openSQLiteStore(path)
+	}
+	return openJSONStore(dsn)
+}
+
+// storePath returns the file system path behind a --nav-data value.
+func storePath(dsn string) string {
+	if path, ok := strings.CutPrefix(dsn, "sqlite://"); ok {
+		return path
+	}
+	return dsn
+}
+
+func emptyData() DataFile {
+	return DataFile{SchemaVersion: currentSchemaVersion, NextID: 1, Categories: []Category{}, Items: []Item{}, Admin: defaultAdmin(), Trash: []TrashEntry{}}
+}
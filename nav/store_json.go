@@ -0,0 +1,266 @@
+package nav
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+var (
+	errDataConflict  = errors.New("data file changed on disk")
+	errDataFileEmpty = errors.New("data file is empty")
+)
+
+// jsonStore keeps the whole DataFile in one JSON file that is rewritten on
+// every update. Sessions are kept in memory only.
+//
+// The store remembers the hash of the content it last read or wrote. If the
+// file has been edited by someone else since, writes fail with
+// errDataConflict until Reload has picked up the outside change.
+type jsonStore struct {
+	mu       sync.Mutex
+	path     string
+	data     DataFile
+	sum      [sha256.Size]byte
+	sessions map[string]string
+}
+
+func openJSONStore(path string) (Store, error) {
+	raw, err := readDataFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, version, err := parseData(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w (refusing to start with empty data; fix the file or restore %s)", err, backupPath(path))
+	}
+	s := &jsonStore{path: path, data: data, sum: sha256.Sum256(raw), sessions: map[string]string{}}
+	if version != currentSchemaVersion {
+		backup := fmt.Sprintf("%s.v%d.bak", path, version)
+		if err := writeFileAtomic(backup, raw, 0644); err != nil {
+			return nil, fmt.Errorf("back up data before migration: %w", err)
+		}
+		if err := s.write(data); err != nil {
+			return nil, fmt.Errorf("write migrated data: %w", err)
+		}
+		log.Printf("nav: migrated %s from schema version %d to %d (backup at %s)", path, version, currentSchemaVersion, backup)
+	}
+	return s, nil
+}
+
+// Reload re-reads the file if it differs from what the store last saw. An
+// invalid file is reported and ignored so a half-finished edit never
+// replaces good data.
+func (s *jsonStore) Reload() (DataFile, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	raw, err := readDataFile(s.path)
+	if err != nil {
+		return DataFile{}, false, err
+	}
+	sum := sha256.Sum256(raw)
+	if sum == s.sum {
+		return DataFile{}, false, nil
+	}
+	data, _, err := parseData(raw)
+	if err != nil {
+		return DataFile{}, false, err
+	}
+	s.data = data
+	s.sum = sum
+	return cloneData(data), true, nil
+}
+
+func (s *jsonStore) Load() (DataFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return cloneData(s.data), nil
+}
+
+func (s *jsonStore) Update(fn func(tx StoreTx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &jsonTx{data: cloneData(s.data)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := s.write(tx.data); err != nil {
+		return err
+	}
+	s.data = tx.data
+	return nil
+}
+
+func (s *jsonStore) Sessions() (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]string, len(s.sessions))
+	for k, v := range s.sessions {
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (s *jsonStore) SaveSession(token, username string) error {
+	s.mu.Lock()
+	s.sessions[token] = username
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *jsonStore) DeleteSession(token string) error {
+	s.mu.Lock()
+	delete(s.sessions, token)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *jsonStore) write(data DataFile) error {
+	data.SchemaVersion = currentSchemaVersion
+	payload, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	current, err := readDataFile(s.path)
+	if err != nil {
+		return err
+	}
+	if current != nil && sha256.Sum256(current) != s.sum {
+		return errDataConflict
+	}
+	if err := backupFile(s.path, current); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path, payload, 0644); err != nil {
+		return err
+	}
+	s.sum = sha256.Sum256(payload)
+	return nil
+}
+
+type jsonTx struct {
+	data DataFile
+}
+
+func (tx *jsonTx) PutCategory(cat Category) error {
+	for i := range tx.data.Categories {
+		if tx.data.Categories[i].ID == cat.ID {
+			tx.data.Categories[i] = cat
+			return nil
+		}
+	}
+	tx.data.Categories = append(tx.data.Categories, cat)
+	return nil
+}
+
+func (tx *jsonTx) DeleteCategory(id uint32) error {
+	filtered := tx.data.Categories[:0]
+	for _, cat := range tx.data.Categories {
+		if cat.ID != id {
+			filtered = append(filtered, cat)
+		}
+	}
+	tx.data.Categories = filtered
+	return nil
+}
+
+func (tx *jsonTx) PutItem(item Item) error {
+	for i := range tx.data.Items {
+		if tx.data.Items[i].ID == item.ID {
+			tx.data.Items[i] = item
+			return nil
+		}
+	}
+	tx.data.Items = append(tx.data.Items, item)
+	return nil
+}
+
+func (tx *jsonTx) DeleteItem(id uint32) error {
+	filtered := tx.data.Items[:0]
+	for _, item := range tx.data.Items {
+		if item.ID != id {
+			filtered = append(filtered, item)
+		}
+	}
+	tx.data.Items = filtered
+	return nil
+}
+
+func (tx *jsonTx) SetAdmin(admin AdminAuth) error {
+	tx.data.Admin = admin
+	return nil
+}
+
+func (tx *jsonTx) SetNextID(next uint32) error {
+	tx.data.NextID = next
+	return nil
+}
+
+func (tx *jsonTx) PutTrash(entry TrashEntry) error {
+	for i := range tx.data.Trash {
+		if tx.data.Trash[i].ID == entry.ID {
+			tx.data.Trash[i] = entry
+			return nil
+		}
+	}
+	tx.data.Trash = append(tx.data.Trash, entry)
+	return nil
+}
+
+func (tx *jsonTx) DeleteTrash(id uint32) error {
+	filtered := tx.data.Trash[:0]
+	for _, entry := range tx.data.Trash {
+		if entry.ID != id {
+			filtered = append(filtered, entry)
+		}
+	}
+	tx.data.Trash = filtered
+	return nil
+}
+
+func (tx *jsonTx) Replace(data DataFile) error {
+	tx.data = cloneData(data)
+	return nil
+}
+
+func cloneData(data DataFile) DataFile {
+	out := data
+	out.Categories = append([]Category{}, data.Categories...)
+	out.Items = append([]Item{}, data.Items...)
+	out.Trash = append([]TrashEntry{}, data.Trash...)
+	return out
+}
+
+// readDataFile returns the file content, or nil if it does not exist. An
+// existing empty file yields an empty, non-nil slice.
+func readDataFile(path string) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if raw == nil {
+		raw = []byte{}
+	}
+	return raw, nil
+}
+
+// parseData decodes the data file content. Only a missing file starts with
+// default data: an empty one is what an interrupted write leaves behind.
+func parseData(raw []byte) (DataFile, int, error) {
+	if raw == nil {
+		return emptyData(), currentSchemaVersion, nil
+	}
+	if len(raw) == 0 {
+		return DataFile{}, 0, errDataFileEmpty
+	}
+	return decodeDataFile(raw)
+}
@@ -0,0 +1,32 @@
+package nav
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenJSONStoreEmptyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openJSONStore(path); !errors.Is(err, errDataFileEmpty) {
+		t.Fatalf("open empty file: got %v, want %v", err, errDataFileEmpty)
+	}
+}
+
+func TestOpenJSONStoreMissingFile(t *testing.T) {
+	s, err := openJSONStore(filepath.Join(t.TempDir(), "data.json"))
+	if err != nil {
+		t.Fatalf("open missing file: %v", err)
+	}
+	data, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Admin.Username == "" {
+		t.Fatalf("missing file: got no default admin")
+	}
+}
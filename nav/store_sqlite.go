@@ -0,0 +1,333 @@
+//go:build cgo
+
+package nav
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteStore keeps one row per category and item, so an update only
+// touches the records it changes. Records are stored as JSON documents
+// to keep the schema independent of the Go structs.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS meta (key TEXT PRIMARY KEY, value TEXT NOT NULL);
+CREATE TABLE IF NOT EXISTS categories (id INTEGER PRIMARY KEY, doc TEXT NOT NULL);
+CREATE TABLE IF NOT EXISTS items (id INTEGER PRIMARY KEY, doc TEXT NOT NULL);
+CREATE TABLE IF NOT EXISTS trash (id INTEGER PRIMARY KEY, doc TEXT NOT NULL);
+CREATE TABLE IF NOT EXISTS sessions (token TEXT PRIMARY KEY, username TEXT NOT NULL);
+`
+
+func openSQLiteStore(path string) (Store, error) {
+	if path == "" {
+		return nil, errors.New("sqlite store: empty database path")
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=on")
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite %s: %w", path, err)
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("init sqlite %s: %w", path, err)
+	}
+	s := &sqliteStore{db: db}
+	if err := s.migrate(path); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("migrate sqlite %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// migrate brings the stored records up to currentSchemaVersion. The
+// records are assembled into a data document and run through the same
+// migrations as the JSON file, after a copy of the database is saved.
+func (s *sqliteStore) migrate(path string) error {
+	meta, err := s.meta()
+	if err != nil {
+		return err
+	}
+	version := 0
+	if v, ok := meta["schema_version"]; ok {
+		if version, err = strconv.Atoi(v); err != nil {
+			return fmt.Errorf("invalid schema_version %q", v)
+		}
+	} else if _, ok := meta["next_id"]; !ok {
+		_, err := s.db.Exec("INSERT OR REPLACE INTO meta (key, value) VALUES ('schema_version', ?)", strconv.Itoa(currentSchemaVersion))
+		return err
+	}
+	if version == currentSchemaVersion {
+		return nil
+	}
+	if version > currentSchemaVersion {
+		return fmt.Errorf("database schema version %d is newer than supported version %d", version, currentSchemaVersion)
+	}
+
+	backup := fmt.Sprintf("%s.v%d.bak", path, version)
+	_ = os.Remove(backup)
+	if _, err := s.db.Exec("VACUUM INTO ?", backup); err != nil {
+		return fmt.Errorf("back up database before migration: %w", err)
+	}
+
+	doc := map[string]json.RawMessage{}
+	if v, ok := meta["next_id"]; ok {
+		doc["next_id"] = json.RawMessage(v)
+	}
+	admin, err := json.Marshal(AdminAuth{Username: meta["admin_username"], PasswordHash: meta["admin_password_hash"]})
+	if err != nil {
+		return err
+	}
+	doc["admin"] = admin
+	if doc["categories"], err = rawDocs(s.db, "SELECT doc FROM categories ORDER BY id"); err != nil {
+		return err
+	}
+	if doc["items"], err = rawDocs(s.db, "SELECT doc FROM items ORDER BY id"); err != nil {
+		return err
+	}
+	if doc["trash"], err = rawDocs(s.db, "SELECT doc FROM trash ORDER BY id"); err != nil {
+		return err
+	}
+	if version != 0 {
+		doc["schema_version"] = json.RawMessage(strconv.Itoa(version))
+	}
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	data, _, err := decodeDataFile(raw)
+	if err != nil {
+		return err
+	}
+	if err := s.Update(func(tx StoreTx) error {
+		return tx.Replace(data)
+	}); err != nil {
+		return err
+	}
+	log.Printf("nav: migrated %s from schema version %d to %d (backup at %s)", path, version, currentSchemaVersion, backup)
+	return nil
+}
+
+func rawDocs(db *sql.DB, query string) (json.RawMessage, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	docs := []json.RawMessage{}
+	for rows.Next() {
+		var doc string
+		if err := rows.Scan(&doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, json.RawMessage(doc))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(docs)
+}
+
+func (s *sqliteStore) Load() (DataFile, error) {
+	data := emptyData()
+
+	meta, err := s.meta()
+	if err != nil {
+		return DataFile{}, err
+	}
+	if v, ok := meta["next_id"]; ok {
+		next, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return DataFile{}, fmt.Errorf("sqlite store: invalid next_id %q", v)
+		}
+		if next > 0 {
+			data.NextID = uint32(next)
+		}
+	}
+	if meta["admin_username"] != "" && meta["admin_password_hash"] != "" {
+		data.Admin = AdminAuth{Username: meta["admin_username"], PasswordHash: meta["admin_password_hash"]}
+	}
+
+	if err := loadDocs(s.db, "SELECT doc FROM categories ORDER BY id", &data.Categories); err != nil {
+		return DataFile{}, err
+	}
+	if err := loadDocs(s.db, "SELECT doc FROM items ORDER BY id", &data.Items); err != nil {
+		return DataFile{}, err
+	}
+	if err := loadDocs(s.db, "SELECT doc FROM trash ORDER BY id", &data.Trash); err != nil {
+		return DataFile{}, err
+	}
+	return data, nil
+}
+
+func (s *sqliteStore) meta() (map[string]string, error) {
+	rows, err := s.db.Query("SELECT key, value FROM meta")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]string{}
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		out[k] = v
+	}
+	return out, rows.Err()
+}
+
+func loadDocs[T any](db *sql.DB, query string, out *[]T) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var doc string
+		if err := rows.Scan(&doc); err != nil {
+			return err
+		}
+		var v T
+		if err := json.Unmarshal([]byte(doc), &v); err != nil {
+			return fmt.Errorf("sqlite store: corrupt record: %w", err)
+		}
+		*out = append(*out, v)
+	}
+	return rows.Err()
+}
+
+func (s *sqliteStore) Update(fn func(tx StoreTx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(&sqliteTx{tx: tx}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Sessions() (map[string]string, error) {
+	rows, err := s.db.Query("SELECT token, username FROM sessions")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]string{}
+	for rows.Next() {
+		var token, username string
+		if err := rows.Scan(&token, &username); err != nil {
+			return nil, err
+		}
+		out[token] = username
+	}
+	return out, rows.Err()
+}
+
+func (s *sqliteStore) SaveSession(token, username string) error {
+	_, err := s.db.Exec("INSERT OR REPLACE INTO sessions (token, username) VALUES (?, ?)", token, username)
+	return err
+}
+
+func (s *sqliteStore) DeleteSession(token string) error {
+	_, err := s.db.Exec("DELETE FROM sessions WHERE token = ?", token)
+	return err
+}
+
+type sqliteTx struct {
+	tx *sql.Tx
+}
+
+func (t *sqliteTx) putDoc(table string, id uint32, v any) error {
+	doc, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = t.tx.Exec("INSERT OR REPLACE INTO "+table+" (id, doc) VALUES (?, ?)", id, string(doc))
+	return err
+}
+
+func (t *sqliteTx) setMeta(key, value string) error {
+	_, err := t.tx.Exec("INSERT OR REPLACE INTO meta (key, value) VALUES (?, ?)", key, value)
+	return err
+}
+
+func (t *sqliteTx) PutCategory(cat Category) error {
+	return t.putDoc("categories", cat.ID, cat)
+}
+
+func (t *sqliteTx) DeleteCategory(id uint32) error {
+	_, err := t.tx.Exec("DELETE FROM categories WHERE id = ?", id)
+	return err
+}
+
+func (t *sqliteTx) PutItem(item Item) error {
+	return t.putDoc("items", item.ID, item)
+}
+
+func (t *sqliteTx) DeleteItem(id uint32) error {
+	_, err := t.tx.Exec("DELETE FROM items WHERE id = ?", id)
+	return err
+}
+
+func (t *sqliteTx) SetAdmin(admin AdminAuth) error {
+	if err := t.setMeta("admin_username", admin.Username); err != nil {
+		return err
+	}
+	return t.setMeta("admin_password_hash", admin.PasswordHash)
+}
+
+func (t *sqliteTx) SetNextID(next uint32) error {
+	return t.setMeta("next_id", strconv.FormatUint(uint64(next), 10))
+}
+
+func (t *sqliteTx) PutTrash(entry TrashEntry) error {
+	return t.putDoc("trash", entry.ID, entry)
+}
+
+func (t *sqliteTx) DeleteTrash(id uint32) error {
+	_, err := t.tx.Exec("DELETE FROM trash WHERE id = ?", id)
+	return err
+}
+
+func (t *sqliteTx) Replace(data DataFile) error {
+	for _, table := range []string{"categories", "items", "trash"} {
+		if _, err := t.tx.Exec("DELETE FROM " + table); err != nil {
+			return err
+		}
+	}
+	for _, cat := range data.Categories {
+		if err := t.PutCategory(cat); err != nil {
+			return err
+		}
+	}
+	for _, item := range data.Items {
+		if err := t.PutItem(item); err != nil {
+			return err
+		}
+	}
+	for _, entry := range data.Trash {
+		if err := t.PutTrash(entry); err != nil {
+			return err
+		}
+	}
+	if err := t.SetAdmin(data.Admin); err != nil {
+		return err
+	}
+	if err := t.setMeta("schema_version", strconv.Itoa(currentSchemaVersion)); err != nil {
+		return err
+	}
+	return t.SetNextID(data.NextID)
+}
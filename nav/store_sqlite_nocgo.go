@@ -0,0 +1,9 @@
+//go:build !cgo
+
+package nav
+
+import "errors"
+
+func openSQLiteStore(path string) (Store, error) {
+	return nil, errors.New("sqlite store requires a cgo build")
+}
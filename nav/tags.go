@@ -0,0 +1,208 @@
+package nav
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	maxTagsPerItem = 32
+	maxTagLength   = 64
+)
+
+var errInvalidTags = fmt.Errorf("at most %d tags of up to %d characters", maxTagsPerItem, maxTagLength)
+
+// normalizeTags trims tags and drops empty ones and case-insensitive
+// duplicates, keeping the first spelling.
+func normalizeTags(tags []string) ([]string, error) {
+	var out []string
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.Join(strings.Fields(tag), " ")
+		if tag == "" {
+			continue
+		}
+		if len([]rune(tag)) > maxTagLength {
+			return nil, errInvalidTags
+		}
+		key := strings.ToLower(tag)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, tag)
+	}
+	if len(out) > maxTagsPerItem {
+		return nil, errInvalidTags
+	}
+	return out, nil
+}
+
+func hasTag(item Item, tag string) bool {
+	for _, t := range item.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterItemsByTags keeps the items carrying every one of tags.
+func filterItemsByTags(items []Item, tags []string) []Item {
+	out := []Item{}
+	for _, item := range items {
+		match := true
+		for _, tag := range tags {
+			if !hasTag(item, tag) {
+				match = false
+				break
+			}
+		}
+		if match {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// tagFilter reads the tag filter of a listing request: repeated tag
+// parameters and/or a comma-separated tags parameter.
+func tagFilter(r *http.Request) []string {
+	q := r.URL.Query()
+	tags := q["tag"]
+	if v := q.Get("tags"); v != "" {
+		tags = append(tags, strings.Split(v, ",")...)
+	}
+	tags, _ = normalizeTags(tags)
+	return tags
+}
+
+type tagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+func (s *AppState) handleListTags(w http.ResponseWriter, r *http.Request) {
+	counts := map[string]*tagCount{}
+	for _, item := range s.visibleItems(r) {
+		for _, tag := range item.Tags {
+			key := strings.ToLower(tag)
+			if counts[key] == nil {
+				counts[key] = &tagCount{Tag: tag}
+			}
+			counts[key].Count++
+		}
+	}
+
+	out := make([]tagCount, 0, len(counts))
+	for _, c := range counts {
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return strings.ToLower(out[i].Tag) < strings.ToLower(out[j].Tag)
+	})
+	writeJSONWithETag(w, r, out)
+}
+
+// retagLocked rewrites tag on every item carrying it: to is substituted
+// (merging with an existing to tag) or, when empty, the tag is removed.
+func (s *AppState) retagLocked(r *http.Request, action, tag, to string) ([]Item, error) {
+	var changed []Item
+	for _, item := range s.items {
+		if !hasTag(item, tag) {
+			continue
+		}
+		next := item
+		next.Tags = nil
+		for _, t := range item.Tags {
+			if !strings.EqualFold(t, tag) {
+				next.Tags = append(next.Tags, t)
+			} else if to != "" {
+				next.Tags = append(next.Tags, to)
+			}
+		}
+		next.Tags, _ = normalizeTags(next.Tags)
+		next.Rev = item.Rev + 1
+		changed = append(changed, next)
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+	err := s.commit(func(tx StoreTx) error {
+		for _, item := range changed {
+			if err := tx.PutItem(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func() {
+		byID := make(map[uint32]Item, len(changed))
+		for _, item := range changed {
+			byID[item.ID] = item
+		}
+		for i, item := range s.items {
+			if next, ok := byID[item.ID]; ok {
+				s.items[i] = next
+				s.events.publish("item.updated", next)
+			}
+		}
+		s.audit(r, action, "tag:"+tag, map[string]any{"tag": tag}, map[string]any{"tag": to, "items": len(changed)})
+	})
+	return changed, err
+}
+
+// handleRenameTag renames tag on all items. Renaming onto an existing tag
+// merges the two.
+func (s *AppState) handleRenameTag(w http.ResponseWriter, r *http.Request, tag string) {
+	body, err := readBody(r, 64*1024)
+	if err != nil {
+		writeText(w, http.StatusBadRequest, "invalid body")
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeText(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	to, err := normalizeTags([]string{req.Name})
+	if err != nil || len(to) == 0 {
+		writeText(w, http.StatusBadRequest, "invalid tag name")
+		return
+	}
+
+	s.mu.Lock()
+	changed, err := s.retagLocked(r, "tag.rename", tag, to[0])
+	s.mu.Unlock()
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	if changed == nil {
+		writeText(w, http.StatusNotFound, "not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"tag": to[0], "items_updated": len(changed)})
+}
+
+func (s *AppState) handleDeleteTag(w http.ResponseWriter, r *http.Request, tag string) {
+	s.mu.Lock()
+	changed, err := s.retagLocked(r, "tag.delete", tag, "")
+	s.mu.Unlock()
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	if changed == nil {
+		writeText(w, http.StatusNotFound, "not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items_updated": len(changed)})
+}
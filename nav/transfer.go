@@ -0,0 +1,323 @@
+package nav
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const maxImportBytes = 10 * 1024 * 1024
+
+// importSet is the format independent result of parsing an import file.
+// Category names are matched case-insensitively; an empty name means the
+// item has no category.
+type importSet struct {
+	categories []string
+	items      []importItem
+	errors     []importError
+}
+
+type importItem struct {
+	category string
+	item     Item
+	order    *int32
+}
+
+// importError points at a record of the import file that was skipped.
+// Row counts records in file order, starting at 1.
+type importError struct {
+	Row   int    `json:"row"`
+	Field string `json:"field,omitempty"`
+	Error string `json:"error"`
+}
+
+func (set *importSet) addError(row int, field, msg string) {
+	set.errors = append(set.errors, importError{Row: row, Field: field, Error: msg})
+}
+
+// validImportURL accepts absolute http(s) URLs, which is what the nav page
+// can link to.
+func validImportURL(raw string) bool {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func (set *importSet) addCategory(name string) {
+	for _, existing := range set.categories {
+		if strings.EqualFold(existing, name) {
+			return
+		}
+	}
+	set.categories = append(set.categories, name)
+}
+
+type importOptions struct {
+	replace        bool
+	skipDuplicates bool
+	strict         bool
+}
+
+type importResult struct {
+	Mode              string        `json:"mode"`
+	CategoriesCreated int           `json:"categories_created"`
+	ItemsCreated      int           `json:"items_created"`
+	DuplicatesSkipped int           `json:"duplicates_skipped"`
+	Errors            []importError `json:"errors"`
+}
+
+func parseImportOptions(r *http.Request) (importOptions, bool) {
+	q := r.URL.Query()
+	var opts importOptions
+	switch q.Get("mode") {
+	case "", "merge":
+	case "replace":
+		opts.replace = true
+	default:
+		return opts, false
+	}
+	var ok1, ok2 bool
+	opts.skipDuplicates, ok1 = queryBool(q, "skip_duplicates", true)
+	opts.strict, ok2 = queryBool(q, "strict", false)
+	return opts, ok1 && ok2
+}
+
+// queryBool reads an optional 1/true/0/false query parameter.
+func queryBool(q url.Values, name string, def bool) (bool, bool) {
+	switch q.Get(name) {
+	case "":
+		return def, true
+	case "1", "true":
+		return true, true
+	case "0", "false":
+		return false, true
+	}
+	return def, false
+}
+
+// normalizeURL gives a comparison key for duplicate detection: scheme and
+// host are lowercased and a trailing slash is dropped.
+func normalizeURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return strings.TrimSuffix(strings.ToLower(raw), "/")
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	return strings.TrimSuffix(u.String(), "/")
+}
+
+// applyImportLocked builds the records for an import. In merge mode
+// categories are matched by name and new items are appended after the
+// existing ones; in replace mode the imported records replace all items
+// and categories. New records always get fresh IDs.
+func (s *AppState) applyImportLocked(set importSet, opts importOptions) (DataFile, importResult) {
+	data := s.dataLocked()
+	data.Categories = append([]Category{}, data.Categories...)
+	data.Items = append([]Item{}, data.Items...)
+	res := importResult{Mode: "merge", Errors: set.errors}
+	if res.Errors == nil {
+		res.Errors = []importError{}
+	}
+	if opts.replace {
+		res.Mode = "replace"
+		data.Categories = []Category{}
+		data.Items = []Item{}
+	}
+
+	catByName := map[string]uint32{}
+	var maxCatOrder int32
+	for _, cat := range data.Categories {
+		catByName[strings.ToLower(cat.Name)] = cat.ID
+		maxCatOrder = max(maxCatOrder, cat.Order)
+	}
+	ensureCategory := func(name string) *uint32 {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil
+		}
+		if id, ok := catByName[strings.ToLower(name)]; ok {
+			return &id
+		}
+		id := data.NextID
+		data.NextID++
+		if len(data.Categories) > 0 {
+			maxCatOrder++
+		}
+		data.Categories = append(data.Categories, Category{ID: id, Name: name, Order: maxCatOrder, Rev: 1})
+		catByName[strings.ToLower(name)] = id
+		res.CategoriesCreated++
+		return &id
+	}
+	for _, name := range set.categories {
+		ensureCategory(name)
+	}
+
+	seen := map[string]bool{}
+	nextOrder := map[uint32]int32{}
+	for _, item := range data.Items {
+		seen[normalizeURL(item.URL)] = true
+		key := uint32(0)
+		if item.CategoryID != nil {
+			key = *item.CategoryID
+		}
+		nextOrder[key] = max(nextOrder[key], item.Order+1)
+	}
+	for _, in := range set.items {
+		key := normalizeURL(in.item.URL)
+		if opts.skipDuplicates && seen[key] {
+			res.DuplicatesSkipped++
+			continue
+		}
+		seen[key] = true
+		item := in.item
+		item.ID = data.NextID
+		data.NextID++
+		item.Rev = 1
+		item.CategoryID = ensureCategory(in.category)
+		orderKey := uint32(0)
+		if item.CategoryID != nil {
+			orderKey = *item.CategoryID
+		}
+		if in.order != nil {
+			item.Order = *in.order
+			nextOrder[orderKey] = max(nextOrder[orderKey], item.Order+1)
+		} else {
+			item.Order = nextOrder[orderKey]
+			nextOrder[orderKey]++
+		}
+		data.Items = append(data.Items, item)
+		res.ItemsCreated++
+	}
+	return data, res
+}
+
+func (s *AppState) handleImport(w http.ResponseWriter, r *http.Request) {
+	opts, ok := parseImportOptions(r)
+	if !ok {
+		writeText(w, http.StatusBadRequest, "invalid options")
+		return
+	}
+	body, err := readBody(r, maxImportBytes)
+	if err != nil {
+		writeText(w, http.StatusBadRequest, "invalid body")
+		return
+	}
+
+	var set importSet
+	switch r.URL.Query().Get("format") {
+	case "html":
+		set, err = parseBookmarksHTML(body)
+	case "csv":
+		set, err = parseCSV(body)
+	case "opml":
+		set, err = parseOPML(body)
+	default:
+		writeText(w, http.StatusBadRequest, "unsupported format")
+		return
+	}
+	if err != nil {
+		writeText(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if opts.strict && len(set.errors) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"errors": set.errors})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, res := s.applyImportLocked(set, opts)
+	before := dataSummary(s.dataLocked())
+	firstNew := s.nextID
+	err = s.commitBulk(func(tx StoreTx) error {
+		if opts.replace {
+			return tx.Replace(data)
+		}
+		for _, cat := range data.Categories {
+			if cat.ID >= firstNew {
+				if err := tx.PutCategory(cat); err != nil {
+					return err
+				}
+			}
+		}
+		for _, item := range data.Items {
+			if item.ID >= firstNew {
+				if err := tx.PutItem(item); err != nil {
+					return err
+				}
+			}
+		}
+		return tx.SetNextID(data.NextID)
+	}, func() {
+		s.audit(r, "data.import", "", before, res)
+		s.nextID = data.NextID
+		s.items = data.Items
+		s.categories = data.Categories
+		s.events.publish(eventTypeRestored, map[string]string{"reason": "import"})
+	})
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *AppState) handleExport(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	cats := sortedCategories(s.categories)
+	items := sortedItems(s.items)
+	s.mu.Unlock()
+
+	switch r.URL.Query().Get("format") {
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="bookmarks.html"`)
+		w.WriteHeader(http.StatusOK)
+		_ = writeBookmarksHTML(w, cats, items)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="nav.csv"`)
+		w.WriteHeader(http.StatusOK)
+		_ = writeCSV(w, cats, items)
+	case "opml":
+		w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="nav.opml"`)
+		w.WriteHeader(http.StatusOK)
+		_ = writeOPML(w, cats, items)
+	default:
+		writeText(w, http.StatusBadRequest, "unsupported format")
+	}
+}
+
+func categoryNames(cats []Category) map[uint32]string {
+	out := make(map[uint32]string, len(cats))
+	for _, cat := range cats {
+		out[cat.ID] = cat.Name
+	}
+	return out
+}
+
+func sortedCategories(cats []Category) []Category {
+	out := append([]Category{}, cats...)
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Order != out[j].Order {
+			return out[i].Order < out[j].Order
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+func sortedItems(items []Item) []Item {
+	out := append([]Item{}, items...)
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Order != out[j].Order {
+			return out[i].Order < out[j].Order
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
@@ -0,0 +1,356 @@
+package nav
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	defaultTrashRetention = 30 * 24 * time.Hour
+	trashPurgeInterval    = time.Hour
+)
+
+// TrashEntry holds a deleted item or category until it is restored or
+// purged. Items and categories share one ID sequence, so the record ID
+// identifies the entry.
+type TrashEntry struct {
+	ID            uint32    `json:"id"`
+	Kind          string    `json:"kind"`
+	DeletedAt     time.Time `json:"deleted_at"`
+	DeletedBy     string    `json:"deleted_by,omitempty"`
+	Item          *Item     `json:"item,omitempty"`
+	Category      *Category `json:"category,omitempty"`
+	DetachedItems []uint32  `json:"detached_items,omitempty"`
+	// Subtree lists the subcategories deleted along with a category; they
+	// are restored with it.
+	Subtree []uint32 `json:"subtree,omitempty"`
+	// ReparentedChildren lists the subcategories that moved up to the
+	// deleted category's parent.
+	ReparentedChildren []uint32 `json:"reparented_children,omitempty"`
+}
+
+const (
+	trashKindItem     = "item"
+	trashKindCategory = "category"
+)
+
+func (e TrashEntry) target() string {
+	if e.Kind == trashKindCategory {
+		return categoryTarget(e.ID)
+	}
+	return itemTarget(e.ID)
+}
+
+func (s *AppState) trashIndexLocked(id uint32) int {
+	for i := range s.trash {
+		if s.trash[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *AppState) withoutTrashLocked(id uint32) []TrashEntry {
+	out := make([]TrashEntry, 0, len(s.trash))
+	for _, e := range s.trash {
+		if e.ID != id {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func (s *AppState) categoryExistsLocked(id uint32) bool {
+	for _, cat := range s.categories {
+		if cat.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// liveLocked reports whether a category or item with the given ID exists.
+// Trash entries for live records cannot be restored.
+func (s *AppState) liveLocked(id uint32) bool {
+	if s.categoryExistsLocked(id) {
+		return true
+	}
+	for _, item := range s.items {
+		if item.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *AppState) handleListTrash(w http.ResponseWriter) {
+	s.mu.Lock()
+	list := append([]TrashEntry{}, s.trash...)
+	s.mu.Unlock()
+	sort.SliceStable(list, func(i, j int) bool { return list[i].DeletedAt.After(list[j].DeletedAt) })
+	writeJSON(w, http.StatusOK, list)
+}
+
+// handleRestoreTrash puts a deleted record back. A restored item whose
+// category is gone becomes uncategorized; a restored category takes back
+// the items it detached, unless they have been moved elsewhere since.
+// An entry whose ID is live again, e.g. after a rollback, is a conflict.
+func (s *AppState) handleRestoreTrash(w http.ResponseWriter, r *http.Request, id uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := s.trashIndexLocked(id)
+	if idx < 0 {
+		writeText(w, http.StatusNotFound, "not found")
+		return
+	}
+	entry := s.trash[idx]
+	if s.liveLocked(id) {
+		writeText(w, http.StatusConflict, "id already in use")
+		return
+	}
+	trash := s.withoutTrashLocked(id)
+
+	var err error
+	switch entry.Kind {
+	case trashKindItem:
+		item := *entry.Item
+		if item.CategoryID != nil && !s.categoryExistsLocked(*item.CategoryID) {
+			item.CategoryID = nil
+		}
+		if aliasTaken(s.items, item.Alias, item.ID) {
+			item.Alias = ""
+		}
+		item.Rev++
+		err = s.commit(func(tx StoreTx) error {
+			if err := tx.DeleteTrash(id); err != nil {
+				return err
+			}
+			return tx.PutItem(item)
+		}, func() {
+			s.audit(r, "trash.restore", itemTarget(id), nil, item)
+			s.trash = trash
+			s.items = append(s.items, item)
+			s.events.publish("item.restored", item)
+		})
+		if err == nil {
+			w.Header().Set("ETag", itemETag(item))
+			writeJSON(w, http.StatusOK, item)
+		}
+	case trashKindCategory:
+		var cat Category
+		cat, err = s.restoreCategoryLocked(r, entry)
+		if err == nil {
+			w.Header().Set("ETag", categoryETag(cat))
+			writeJSON(w, http.StatusOK, cat)
+		}
+	default:
+		writeText(w, http.StatusInternalServerError, "unknown trash entry")
+		return
+	}
+	if err != nil {
+		writeSaveError(w, err)
+	}
+}
+
+// restoreCategoryLocked puts a deleted category back together with the
+// subcategories deleted along with it. Categories whose parent is gone move
+// to the top level; items and subcategories detached by the delete are
+// taken back unless they have been moved elsewhere since.
+func (s *AppState) restoreCategoryLocked(r *http.Request, entry TrashEntry) (Category, error) {
+	restoring := []TrashEntry{entry}
+	for _, sub := range entry.Subtree {
+		if i := s.trashIndexLocked(sub); i >= 0 && s.trash[i].Kind == trashKindCategory && !s.liveLocked(sub) {
+			restoring = append(restoring, s.trash[i])
+		}
+	}
+	ids := make(map[uint32]bool, len(s.categories)+len(restoring))
+	for _, cat := range s.categories {
+		ids[cat.ID] = true
+	}
+	back := make(map[uint32]bool, len(restoring))
+	for _, e := range restoring {
+		ids[e.ID] = true
+		back[e.ID] = true
+	}
+	trash := make([]TrashEntry, 0, len(s.trash))
+	for _, e := range s.trash {
+		if !back[e.ID] {
+			trash = append(trash, e)
+		}
+	}
+
+	categories := append([]Category{}, s.categories...)
+	var restored, adopted []Category
+	relink := map[uint32]uint32{}
+	for _, e := range restoring {
+		cat := *e.Category
+		cat.Rev++
+		if cat.ParentID != nil && !ids[*cat.ParentID] {
+			cat.ParentID = nil
+		}
+		restored = append(restored, cat)
+		for _, itemID := range e.DetachedItems {
+			relink[itemID] = cat.ID
+		}
+	}
+	readopt := make(map[uint32]bool, len(entry.ReparentedChildren))
+	for _, childID := range entry.ReparentedChildren {
+		readopt[childID] = true
+	}
+	for i := range categories {
+		if readopt[categories[i].ID] && sameParent(categories[i].ParentID, entry.Category.ParentID) {
+			parent := entry.ID
+			categories[i].ParentID = &parent
+			categories[i].Rev++
+			adopted = append(adopted, categories[i])
+		}
+	}
+	categories = append(categories, restored...)
+
+	items := append([]Item{}, s.items...)
+	var relinked []Item
+	for i := range items {
+		if catID, ok := relink[items[i].ID]; ok && items[i].CategoryID == nil {
+			items[i].CategoryID = &catID
+			items[i].Rev++
+			relinked = append(relinked, items[i])
+		}
+	}
+
+	err := s.commit(func(tx StoreTx) error {
+		for _, e := range restoring {
+			if err := tx.DeleteTrash(e.ID); err != nil {
+				return err
+			}
+		}
+		for _, cat := range append(restored, adopted...) {
+			if err := tx.PutCategory(cat); err != nil {
+				return err
+			}
+		}
+		for _, item := range relinked {
+			if err := tx.PutItem(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func() {
+		relinkedIDs := make([]uint32, 0, len(relinked))
+		for _, item := range relinked {
+			relinkedIDs = append(relinkedIDs, item.ID)
+		}
+		s.audit(r, "trash.restore", categoryTarget(entry.ID), nil, map[string]any{"categories": restored, "relinked_items": relinkedIDs})
+		s.trash = trash
+		s.categories = categories
+		s.items = items
+		for _, cat := range restored {
+			s.events.publish("category.restored", cat)
+		}
+		for _, cat := range adopted {
+			s.events.publish("category.updated", cat)
+		}
+		for _, item := range relinked {
+			s.events.publish("item.updated", item)
+		}
+	})
+	return restored[0], err
+}
+
+func sameParent(a, b *uint32) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func (s *AppState) handlePurgeTrash(w http.ResponseWriter, r *http.Request, id uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := s.trashIndexLocked(id)
+	if idx < 0 {
+		writeText(w, http.StatusNotFound, "not found")
+		return
+	}
+	entry := s.trash[idx]
+	trash := s.withoutTrashLocked(id)
+	if err := s.commit(func(tx StoreTx) error {
+		return tx.DeleteTrash(id)
+	}, func() {
+		s.audit(r, "trash.purge", entry.target(), entry, nil)
+		s.trash = trash
+	}); err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func (s *AppState) handleEmptyTrash(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := s.trash
+	if err := s.commit(func(tx StoreTx) error {
+		for _, e := range purged {
+			if err := tx.DeleteTrash(e.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func() {
+		s.audit(r, "trash.empty", "", map[string]int{"entries": len(purged)}, nil)
+		s.trash = []TrashEntry{}
+	}); err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"purged": len(purged)})
+}
+
+// purgeExpiredTrash permanently removes entries older than the retention.
+func (s *AppState) purgeExpiredTrash() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().Add(-s.trashRetention)
+	var expired []uint32
+	kept := make([]TrashEntry, 0, len(s.trash))
+	for _, e := range s.trash {
+		if e.DeletedAt.Before(cutoff) {
+			expired = append(expired, e.ID)
+			continue
+		}
+		kept = append(kept, e)
+	}
+	if len(expired) == 0 {
+		return
+	}
+	err := s.commit(func(tx StoreTx) error {
+		for _, id := range expired {
+			if err := tx.DeleteTrash(id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func() {
+		s.trash = kept
+	})
+	if err != nil {
+		log.Printf("nav: purge expired trash failed: %v", err)
+		return
+	}
+	log.Printf("nav: purged %d expired trash entries", len(expired))
+}
+
+func (s *AppState) runTrashPurger() {
+	s.purgeExpiredTrash()
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.purgeExpiredTrash()
+	}
+}
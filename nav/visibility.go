@@ -0,0 +1,159 @@
+package nav
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Records are public unless their visibility is "private". Public records
+// store an empty visibility, so data from before the field existed stays
+// public.
+const visibilityPrivate = "private"
+
+var errInvalidVisibility = errors.New("visibility must be public or private")
+
+func normalizeVisibility(v string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "", "public":
+		return "", nil
+	case visibilityPrivate:
+		return visibilityPrivate, nil
+	}
+	return "", errInvalidVisibility
+}
+
+// hiddenCategories returns the categories anonymous visitors may not see:
+// private ones and everything below them.
+func hiddenCategories(cats []Category) map[uint32]bool {
+	byID := make(map[uint32]Category, len(cats))
+	for _, cat := range cats {
+		byID[cat.ID] = cat
+	}
+	hidden := map[uint32]bool{}
+	for _, cat := range cats {
+		seen := map[uint32]bool{}
+		for c, ok := cat, true; ok && !seen[c.ID]; {
+			seen[c.ID] = true
+			if c.Visibility == visibilityPrivate {
+				hidden[cat.ID] = true
+				break
+			}
+			if c.ParentID == nil {
+				break
+			}
+			c, ok = byID[*c.ParentID]
+		}
+	}
+	return hidden
+}
+
+func itemHidden(item Item, hiddenCats map[uint32]bool) bool {
+	return item.Visibility == visibilityPrivate || (item.CategoryID != nil && hiddenCats[*item.CategoryID])
+}
+
+// publicData drops the records anonymous visitors may not see.
+func publicData(cats []Category, items []Item) ([]Category, []Item) {
+	hidden := hiddenCategories(cats)
+	outCats := make([]Category, 0, len(cats))
+	for _, cat := range cats {
+		if !hidden[cat.ID] {
+			outCats = append(outCats, cat)
+		}
+	}
+	outItems := make([]Item, 0, len(items))
+	for _, item := range items {
+		if !itemHidden(item, hidden) {
+			outItems = append(outItems, item)
+		}
+	}
+	return outCats, outItems
+}
+
+// hiddenItemIDsLocked returns the items anonymous visitors may not see.
+func (s *AppState) hiddenItemIDsLocked() map[uint32]bool {
+	out := map[uint32]bool{}
+	for _, item := range s.items {
+		if itemHidden(item, s.hiddenCats) {
+			out[item.ID] = true
+		}
+	}
+	return out
+}
+
+// visibleItems returns the items the request may see: all of them for
+// logged-in admins, the public ones otherwise.
+func (s *AppState) visibleItems(r *http.Request) []Item {
+	_, admin := s.sessionUserFor(r)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if admin {
+		return append([]Item{}, s.items...)
+	}
+	items := make([]Item, 0, len(s.items))
+	for _, item := range s.items {
+		if !itemHidden(item, s.hiddenCats) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// visibleItem looks up one item the request may see. hidden reports
+// whether anonymous visitors may not see it, so a logged-in admin sees it
+// only through their session.
+func (s *AppState) visibleItem(r *http.Request, id uint32) (item Item, hidden bool, ok bool) {
+	s.mu.Lock()
+	for _, it := range s.items {
+		if it.ID == id {
+			item, hidden, ok = it, itemHidden(it, s.hiddenCats), true
+			break
+		}
+	}
+	s.mu.Unlock()
+	if ok && hidden {
+		_, ok = s.sessionUserFor(r)
+	}
+	return item, hidden, ok
+}
+
+// syncVisibilityLocked tracks the hidden categories after a commit. When
+// they change, whole groups of items appear or disappear for anonymous
+// visitors, so they are told to refetch.
+func (s *AppState) syncVisibilityLocked() {
+	hidden := hiddenCategories(s.categories)
+	changed := len(hidden) != len(s.hiddenCats)
+	for id := range hidden {
+		changed = changed || !s.hiddenCats[id]
+	}
+	s.hiddenCats = hidden
+	if changed {
+		s.events.publish(eventTypeRestored, map[string]string{"reason": "visibility"})
+	}
+}
+
+// anonymousEvent adapts a change event for a subscriber who is not logged
+// in: records they may not see are reported as deleted, or left out when
+// they were just created or restored.
+func (s *AppState) anonymousEvent(ev event) (event, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var hidden bool
+	var id uint32
+	switch data := ev.data.(type) {
+	case Item:
+		hidden, id = itemHidden(data, s.hiddenCats), data.ID
+	case Category:
+		hidden, id = data.Visibility == visibilityPrivate || s.hiddenCats[data.ID], data.ID
+	}
+	if !hidden {
+		return ev, true
+	}
+	kind, action, _ := strings.Cut(ev.typ, ".")
+	if action == "created" || action == "restored" {
+		return ev, false
+	}
+	ev.typ = kind + ".deleted"
+	ev.data = map[string]uint32{"id": id}
+	return ev, true
+}
@@ -0,0 +1,69 @@
+package nav
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHiddenItemLookups(t *testing.T) {
+	c := newTestClient(t)
+	var cat Category
+	c.decode(c.do("POST", "/api/category", `{"name":"private","visibility":"private"}`), &cat)
+	var public, hidden Item
+	c.decode(c.do("POST", "/api/item", `{"name":"a","url":"https://a.invalid/{n}","alias":"t/{n}"}`), &public)
+	c.decode(c.do("POST", "/api/item", fmt.Sprintf(`{"name":"b","url":"https://b.invalid/","alias":"t/x","category_id":%d}`, cat.ID)), &hidden)
+
+	anon := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c.h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+	for _, tc := range []struct {
+		path       string
+		anonCode   int
+		anonTarget string
+		adminCode  int
+	}{
+		{fmt.Sprintf("/go/%d", public.ID), http.StatusFound, "", http.StatusFound},
+		{fmt.Sprintf("/go/%d", hidden.ID), http.StatusNotFound, "", http.StatusFound},
+		{"/t/x", http.StatusFound, "https://a.invalid/x", http.StatusFound},
+		{fmt.Sprintf("/icons/%d", hidden.ID), http.StatusNotFound, "", http.StatusOK},
+	} {
+		w := anon(tc.path)
+		if w.Code != tc.anonCode {
+			t.Errorf("anonymous %s: got %d, want %d", tc.path, w.Code, tc.anonCode)
+		}
+		if tc.anonTarget != "" && w.Header().Get("Location") != tc.anonTarget {
+			t.Errorf("anonymous %s: redirected to %q, want %q", tc.path, w.Header().Get("Location"), tc.anonTarget)
+		}
+		if w := c.do("GET", tc.path, ""); w.Code != tc.adminCode {
+			t.Errorf("admin %s: got %d, want %d", tc.path, w.Code, tc.adminCode)
+		}
+	}
+	if loc := c.do("GET", "/t/x", "").Header().Get("Location"); loc != "https://b.invalid/" {
+		t.Errorf("admin /t/x: redirected to %q, want the literal alias", loc)
+	}
+}
+
+func TestHiddenItemIconCaching(t *testing.T) {
+	c := newTestClient(t)
+	var public, hidden Item
+	c.decode(c.do("POST", "/api/item", `{"name":"a","url":"https://a.invalid/"}`), &public)
+	c.decode(c.do("POST", "/api/item", `{"name":"b","url":"https://b.invalid/","visibility":"private"}`), &hidden)
+
+	for _, tc := range []struct {
+		id    uint32
+		scope string
+	}{{public.ID, "public"}, {hidden.ID, "private"}} {
+		w := c.do("GET", fmt.Sprintf("/icons/%d", tc.id), "")
+		if cc := w.Header().Get("Cache-Control"); !strings.HasPrefix(cc, tc.scope+",") {
+			t.Errorf("icon %d: Cache-Control %q, want %s", tc.id, cc, tc.scope)
+		}
+		if v := w.Header().Get("Vary"); v != "Cookie" {
+			t.Errorf("icon %d: Vary %q, want Cookie", tc.id, v)
+		}
+	}
+}
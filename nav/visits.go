@@ -0,0 +1,356 @@
+package nav
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	visitRetention       = 90 * 24 * time.Hour
+	visitCompactInterval = 24 * time.Hour
+	defaultStatsWindow   = 30 * 24 * time.Hour
+	maxStatsReferrers    = 5
+)
+
+// visit is one click-through. It is stored as a JSON line with short keys
+// to keep the log small.
+type visit struct {
+	Time     int64  `json:"t"`
+	ItemID   uint32 `json:"i"`
+	Client   string `json:"c"`
+	Referrer string `json:"r,omitempty"`
+}
+
+// visitLog appends visits to a file next to the nav data and keeps the
+// last visitRetention of them in memory, in time order. Older visits are
+// dropped from the file by compact.
+type visitLog struct {
+	mu     sync.Mutex
+	path   string
+	visits []visit
+	last   map[uint32]int64
+	salt   []byte
+}
+
+func openVisitLog(path string) (*visitLog, error) {
+	v := &visitLog{path: path, last: map[uint32]int64{}, salt: make([]byte, 16)}
+	if _, err := rand.Read(v.salt); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("open visit log %s: %w", path, err)
+	}
+	if f != nil {
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			var e visit
+			if json.Unmarshal(sc.Bytes(), &e) == nil {
+				v.visits = append(v.visits, e)
+			}
+		}
+		if err := sc.Err(); err != nil {
+			return nil, fmt.Errorf("open visit log %s: %w", path, err)
+		}
+	}
+	sort.SliceStable(v.visits, func(i, j int) bool { return v.visits[i].Time < v.visits[j].Time })
+	for _, e := range v.visits {
+		v.last[e.ItemID] = e.Time
+	}
+	if err := v.compact(time.Now()); err != nil {
+		return nil, fmt.Errorf("compact visit log %s: %w", path, err)
+	}
+	return v, nil
+}
+
+func (v *visitLog) record(e visit) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	f, err := os.OpenFile(v.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	v.visits = append(v.visits, e)
+	v.last[e.ItemID] = e.Time
+	return nil
+}
+
+// compact drops visits older than the retention, along with the last
+// visit times they set, and rewrites the file when any were dropped.
+func (v *visitLog) compact(now time.Time) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	cutoff := now.Add(-visitRetention).Unix()
+	keep := sort.Search(len(v.visits), func(i int) bool { return v.visits[i].Time >= cutoff })
+	if keep == 0 {
+		return nil
+	}
+	v.visits = append([]visit{}, v.visits[keep:]...)
+	v.last = map[uint32]int64{}
+	for _, e := range v.visits {
+		v.last[e.ItemID] = e.Time
+	}
+	var buf bytes.Buffer
+	for _, e := range v.visits {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return writeFileAtomic(v.path, buf.Bytes(), 0600)
+}
+
+// clientID anonymizes a visitor: the address is cut to its /24 (IPv4) or
+// /48 (IPv6) network and hashed with the user agent, the day and a salt
+// that lives only in memory, so IDs cannot be linked across days or
+// restarts.
+func (v *visitLog) clientID(ip, userAgent string, now time.Time) string {
+	network := ip
+	if ip := net.ParseIP(network); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			network = ip4.Mask(net.CIDRMask(24, 32)).String()
+		} else {
+			network = ip.Mask(net.CIDRMask(48, 128)).String()
+		}
+	}
+	h := sha256.New()
+	h.Write(v.salt)
+	fmt.Fprintf(h, "%s\x00%s\x00%s", now.UTC().Format("2006-01-02"), network, userAgent)
+	return hex.EncodeToString(h.Sum(nil)[:4])
+}
+
+// referrerHost keeps only the host of the Referer header.
+func referrerHost(r *http.Request) string {
+	u, err := url.Parse(r.Referer())
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+type referrerCount struct {
+	Host   string `json:"host"`
+	Visits int    `json:"visits"`
+}
+
+type itemStats struct {
+	ID        uint32          `json:"id"`
+	Visits    int             `json:"visits"`
+	Clients   int             `json:"clients"`
+	LastVisit *time.Time      `json:"last_visit"`
+	Referrers []referrerCount `json:"referrers,omitempty"`
+}
+
+// stats counts the visits since the given time for each of items.
+func (v *visitLog) stats(items []Item, since time.Time, referrers bool) []itemStats {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	index := make(map[uint32]int, len(items))
+	out := make([]itemStats, len(items))
+	for i, item := range items {
+		index[item.ID] = i
+		out[i].ID = item.ID
+		if t, ok := v.last[item.ID]; ok {
+			last := time.Unix(t, 0).UTC()
+			out[i].LastVisit = &last
+		}
+	}
+	clients := map[uint32]map[string]bool{}
+	refs := map[uint32]map[string]int{}
+	cutoff := since.Unix()
+	for j := len(v.visits) - 1; j >= 0 && v.visits[j].Time >= cutoff; j-- {
+		e := v.visits[j]
+		i, ok := index[e.ItemID]
+		if !ok {
+			continue
+		}
+		out[i].Visits++
+		if clients[e.ItemID] == nil {
+			clients[e.ItemID] = map[string]bool{}
+		}
+		clients[e.ItemID][e.Client] = true
+		if referrers && e.Referrer != "" {
+			if refs[e.ItemID] == nil {
+				refs[e.ItemID] = map[string]int{}
+			}
+			refs[e.ItemID][e.Referrer]++
+		}
+	}
+	for i := range out {
+		out[i].Clients = len(clients[out[i].ID])
+		for host, n := range refs[out[i].ID] {
+			out[i].Referrers = append(out[i].Referrers, referrerCount{Host: host, Visits: n})
+		}
+		sort.Slice(out[i].Referrers, func(a, b int) bool {
+			ra, rb := out[i].Referrers[a], out[i].Referrers[b]
+			if ra.Visits != rb.Visits {
+				return ra.Visits > rb.Visits
+			}
+			return ra.Host < rb.Host
+		})
+		if len(out[i].Referrers) > maxStatsReferrers {
+			out[i].Referrers = out[i].Referrers[:maxStatsReferrers]
+		}
+	}
+	return out
+}
+
+func (s *AppState) runVisitCompactor() {
+	ticker := time.NewTicker(visitCompactInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if err := s.visits.compact(now); err != nil {
+			log.Printf("nav: compact visit log failed: %v", err)
+		}
+	}
+}
+
+// handleGo redirects to an item's URL and records the visit.
+func (s *AppState) handleGo(w http.ResponseWriter, r *http.Request, id uint32) {
+	item, _, ok := s.visibleItem(r, id)
+	if !ok {
+		writeText(w, http.StatusNotFound, "not found")
+		return
+	}
+	s.redirectVisit(w, r, id, item.URL)
+}
+
+// redirectVisit records a visit to an item and redirects to target.
+// Prefetches and HEAD requests are not counted.
+func (s *AppState) redirectVisit(w http.ResponseWriter, r *http.Request, id uint32, target string) {
+	prefetch := r.Header.Get("Sec-Purpose") != "" || r.Header.Get("Purpose") == "prefetch"
+	if r.Method == http.MethodGet && !prefetch {
+		now := time.Now()
+		e := visit{Time: now.Unix(), ItemID: id, Client: s.visits.clientID(s.clientIP(r), r.UserAgent(), now), Referrer: referrerHost(r)}
+		if err := s.visits.record(e); err != nil {
+			log.Printf("nav: record visit failed: %v", err)
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// parseStatsWindow reads a window such as 24h or 7d, or "all" for every
+// retained visit.
+func parseStatsWindow(v string) (time.Duration, bool) {
+	switch {
+	case v == "":
+		return defaultStatsWindow, true
+	case v == "all":
+		return visitRetention, true
+	case len(v) < 2:
+		return 0, false
+	}
+	n, err := strconv.Atoi(v[:len(v)-1])
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	var d time.Duration
+	switch v[len(v)-1] {
+	case 'h':
+		d = time.Duration(n) * time.Hour
+	case 'd':
+		d = time.Duration(n) * 24 * time.Hour
+	default:
+		return 0, false
+	}
+	return min(d, visitRetention), true
+}
+
+// handleItemStats reports visit counts per item over a window. sort=visits
+// (the default) lists the most used items first, sort=recent the most
+// recently used and sort=id keeps ID order. Private items and referrers
+// are only included for logged-in admins.
+func (s *AppState) handleItemStats(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	windowName := q.Get("window")
+	window, ok := parseStatsWindow(windowName)
+	if !ok {
+		writeText(w, http.StatusBadRequest, "invalid window")
+		return
+	}
+	if windowName == "" {
+		windowName = "30d"
+	}
+	sortBy := q.Get("sort")
+	switch sortBy {
+	case "":
+		sortBy = "visits"
+	case "visits", "recent", "id":
+	default:
+		writeText(w, http.StatusBadRequest, "invalid sort")
+		return
+	}
+	limit := -1
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeText(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = n
+	}
+	_, admin := s.sessionUserFor(r)
+	items := s.visibleItems(r)
+	since := time.Now().Add(-window).UTC().Truncate(time.Second)
+	stats := s.visits.stats(items, since, admin)
+
+	lastUnix := func(st itemStats) int64 {
+		if st.LastVisit == nil {
+			return 0
+		}
+		return st.LastVisit.Unix()
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		a, b := stats[i], stats[j]
+		switch {
+		case sortBy == "visits" && a.Visits != b.Visits:
+			return a.Visits > b.Visits
+		case sortBy != "id" && lastUnix(a) != lastUnix(b):
+			return lastUnix(a) > lastUnix(b)
+		}
+		return a.ID < b.ID
+	})
+	total := 0
+	for _, st := range stats {
+		total += st.Visits
+	}
+	if limit >= 0 && limit < len(stats) {
+		stats = stats[:limit]
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"window": windowName,
+		"since":  since,
+		"total":  total,
+		"items":  stats,
+	})
+}
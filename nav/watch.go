@@ -0,0 +1,134 @@
+package nav
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	watchDebounce = 300 * time.Millisecond
+	watchPoll     = 2 * time.Second
+)
+
+// reloadableStore is implemented by stores whose data can be edited from
+// outside the process.
+type reloadableStore interface {
+	Reload() (DataFile, bool, error)
+}
+
+// watchFile calls notify whenever path may have changed. It watches the
+// parent directory with inotify (so atomic renames are seen) and falls back
+// to polling the file's size and modification time if that is unavailable.
+func watchFile(path string, notify func()) {
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		err = watcher.Add(filepath.Dir(path))
+		if err != nil {
+			_ = watcher.Close()
+		}
+	}
+	if err != nil {
+		log.Printf("nav: watching %s with polling: %v", path, err)
+		go pollFile(path, notify)
+		return
+	}
+	go runWatcher(watcher, path, notify)
+}
+
+func runWatcher(watcher *fsnotify.Watcher, path string, notify func()) {
+	defer watcher.Close()
+	target := filepath.Clean(path)
+	var timer *time.Timer
+	for {
+		select {
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(ev.Name) != target {
+				continue
+			}
+			if timer == nil {
+				timer = time.AfterFunc(watchDebounce, notify)
+			} else {
+				timer.Reset(watchDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("nav: watch %s: %v", path, err)
+		}
+	}
+}
+
+func pollFile(path string, notify func()) {
+	var lastSize int64 = -1
+	var lastMod time.Time
+	if info, err := os.Stat(path); err == nil {
+		lastSize, lastMod = info.Size(), info.ModTime()
+	}
+	ticker := time.NewTicker(watchPoll)
+	defer ticker.Stop()
+	for range ticker.C {
+		size, mod := int64(-1), time.Time{}
+		if info, err := os.Stat(path); err == nil {
+			size, mod = info.Size(), info.ModTime()
+		}
+		if size != lastSize || !mod.Equal(lastMod) {
+			lastSize, lastMod = size, mod
+			notify()
+		}
+	}
+}
+
+// reloadFromDisk picks up an outside edit of the data file. It holds s.mu
+// while the store reloads so no handler can commit against stale state.
+func (s *AppState) reloadFromDisk() {
+	rs, ok := s.store.(reloadableStore)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, changed, err := rs.Reload()
+	if err != nil {
+		log.Printf("nav: ignoring external change to data file: %v", err)
+		return
+	}
+	if !changed {
+		return
+	}
+	log.Printf("nav: reloaded data file after external change")
+	// Records changed by hand need revisions past the ones handed out so
+	// far. They are written back so the store agrees with memory; if that
+	// fails, the file's own revisions are kept instead.
+	bumped := data
+	bumped.Categories = append([]Category{}, data.Categories...)
+	bumped.Items = append([]Item{}, data.Items...)
+	s.bumpRevsLocked(&bumped)
+	if !sameJSON(bumped, data) {
+		err := s.store.Update(func(tx StoreTx) error {
+			return tx.Replace(bumped)
+		})
+		if err != nil {
+			log.Printf("nav: store revisions after reload failed: %v", err)
+		} else {
+			data = bumped
+		}
+	}
+	s.nextID = data.NextID
+	s.items = data.Items
+	s.categories = data.Categories
+	s.admin = data.Admin
+	s.trash = data.Trash
+	if s.trash == nil {
+		s.trash = []TrashEntry{}
+	}
+	s.events.publish(eventTypeRestored, map[string]string{"reason": "reload"})
+	s.afterCommit()
+}
@@ -0,0 +1,46 @@
+package nav
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReloadStoresBumpedRevisions(t *testing.T) {
+	c := newTestClient(t)
+	var item Item
+	c.decode(c.do("POST", "/api/item", `{"name":"before","url":"https://a.invalid/"}`), &item)
+
+	state := c.app.state
+	path := state.store.(*jsonStore).path
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := strings.Replace(string(raw), `"name": "before"`, `"name": "after"`, 1)
+	if err := os.WriteFile(path, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	state.reloadFromDisk()
+
+	state.mu.Lock()
+	live := state.items[0]
+	state.mu.Unlock()
+	if live.Name != "after" || live.Rev <= item.Rev {
+		t.Fatalf("after reload: got %q rev %d, want \"after\" with rev past %d", live.Name, live.Rev, item.Rev)
+	}
+	stored, err := state.store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.Items) != 1 || stored.Items[0].Rev != live.Rev {
+		t.Fatalf("stored revision after reload: got %+v, want rev %d", stored.Items, live.Rev)
+	}
+	reopened, err := openJSONStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := reopened.Load(); len(data.Items) != 1 || data.Items[0].Rev != live.Rev {
+		t.Fatalf("revision on disk after reload: got %+v, want rev %d", data.Items, live.Rev)
+	}
+}